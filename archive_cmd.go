@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"video-downloader-go/internal/archive"
+	"video-downloader-go/internal/util/mylog/color"
+	"video-downloader-go/internal/util/mylog/dlbar"
+)
+
+// archiveUsage 下载存档命令的使用说明
+const archiveUsage = `用法:
+  archive list            列出所有下载记录
+  archive prune           删除输出文件已经不存在的记录
+  archive prune <url>...  删除指定地址的记录`
+
+// runArchiveCommand 执行下载存档相关的命令, 返回程序的退出码
+func runArchiveCommand(args []string) int {
+	a, err := archive.Open(archive.DefaultPath)
+	if err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+		return ExitError
+	}
+
+	if len(args) == 0 {
+		fmt.Println(archiveUsage)
+		return ExitError
+	}
+
+	switch args[0] {
+	case "list":
+		records := a.List()
+		hi := new(dlbar.HintItem)
+		for _, r := range records {
+			fmt.Printf("%s  %10s  %s  %s\n", r.Time.Format("2006-01-02 15:04:05"), hi.Size(r.Size), r.Url, r.Path)
+		}
+		fmt.Println(color.ToGreen(fmt.Sprintf("共 %d 条下载记录", len(records))))
+
+	case "prune":
+		urls := make(map[string]struct{})
+		for _, u := range args[1:] {
+			urls[archive.Normalize(u)] = struct{}{}
+		}
+		removed, err := a.Prune(func(r archive.Record) bool {
+			if len(urls) > 0 {
+				_, ok := urls[r.Url]
+				return ok
+			}
+			_, err := os.Stat(r.Path)
+			return os.IsNotExist(err)
+		})
+		if err != nil {
+			fmt.Println(color.ToRed(err.Error()))
+			return ExitError
+		}
+		fmt.Println(color.ToGreen(fmt.Sprintf("已删除 %d 条下载记录", removed)))
+
+	default:
+		fmt.Println(archiveUsage)
+		return ExitError
+	}
+	return ExitOk
+}
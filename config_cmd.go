@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/util/mylog/color"
+)
+
+// configUsage 配置相关命令的使用说明
+const configUsage = `用法:
+  config explain <url>...  查看源视频地址匹配到的定制化配置以及最终生效的配置`
+
+// runConfigCommand 执行配置相关的命令, 返回程序的退出码
+func runConfigCommand(args []string) int {
+	if len(args) < 2 || args[0] != "explain" {
+		fmt.Println(configUsage)
+		return ExitError
+	}
+
+	if err := config.LoadWithoutEnv(""); err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+		return ExitError
+	}
+	for _, u := range args[1:] {
+		explainUrl(u)
+	}
+	return ExitOk
+}
+
+// explainUrl 输出源视频地址匹配到的定制化配置以及最终生效的配置
+func explainUrl(u string) {
+	fmt.Println(color.ToBlue(u))
+	matches := config.ExplainCustoms(u)
+	if len(matches) == 0 {
+		fmt.Println("  没有匹配的定制化配置, 使用全局配置")
+	}
+	for i, m := range matches {
+		line := fmt.Sprintf("  customs[%d]  %-8s  %s", m.Index, m.Kind, m.Pattern)
+		if i == 0 {
+			fmt.Println(color.ToGreen(line + "  (生效)"))
+		} else {
+			fmt.Println(line + "  (优先级较低, 被忽略)")
+		}
+	}
+
+	chain := make([]string, 0)
+	for _, step := range config.G.Decoder.CustomChain(u) {
+		chain = append(chain, fmt.Sprintf("%s x%d", step.Use, step.MaxRetry))
+	}
+	pps := []string{config.PostProcessNone}
+	if list := config.CustomPostProcessors(u); len(list) > 0 {
+		pps = pps[:0]
+		for _, pp := range list {
+			pps = append(pps, pp.Use)
+		}
+	}
+	fmt.Printf("  解析器：%s\n", strings.Join(chain, " -> "))
+	dl := &config.G.Downloader
+	fmt.Printf("  下载器：%s, 下载目录：%s, 最大尝试次数：%d\n", dl.CustomUse(u), dl.CustomDownloadDir(u), dl.CustomMaxRetry(u))
+	fmt.Printf("  转换器：%s, 输出容器：%s\n", config.G.Transfer.CustomUse(u), config.G.Transfer.CustomContainer(u))
+	fmt.Printf("  后处理器：%s\n", strings.Join(pps, ", "))
+	proxy := "不使用代理"
+	if pu := config.G.Proxy.CustomProxy(u).RawURL(u); pu != nil {
+		proxy = pu.Redacted()
+	}
+	fmt.Printf("  代理：%s\n", proxy)
+	fmt.Printf("  连接池：每个域名保留 %d 个空闲连接, HTTP/2：%v\n", dl.CustomDlThreadCount(u), dl.CustomHTTP2(u))
+}
@@ -0,0 +1,248 @@
+// 下载存档, 记录下载成功的任务, 再次运行时跳过已经下载过的资源
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"video-downloader-go/internal/constant"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPath 下载存档的默认存放路径
+var DefaultPath = filepath.Join(constant.Dir_DataRoot, "archive.jsonl")
+
+// G 全局的下载存档, 为 nil 时不记录也不跳过任何任务
+var G *Archive
+
+// Record 一条下载记录
+type Record struct {
+	Url  string    `json:"url"`  // 规范化后的源视频地址
+	Path string    `json:"path"` // 输出文件路径
+	Size int64     `json:"size"` // 文件大小, 单位: 字节, 为转换容器和后处理之后的大小
+	Time time.Time `json:"time"` // 下载完成时间
+
+	// 输出文件的时长, 未知时为 0
+	// 转换容器和后处理会改变文件大小, 文件被再次修改后只能通过时长判断是否完整
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// Archive 下载存档, 以 JSON Lines 的格式追加写入文件, 每行一条记录
+//
+// 同一个地址存在多条记录时, 以最后一条为准
+type Archive struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]Record
+}
+
+// Open 读取下载存档, 文件不存在时返回空的存档, 写入记录时再创建
+func Open(path string) (*Archive, error) {
+	a := &Archive{path: path, records: make(map[string]Record)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "打开下载存档失败：%s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r Record
+		if err = json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, errors.Wrapf(err, "解析下载存档失败, 第 %d 行：%s", lineNo, path)
+		}
+		a.records[r.Url] = r
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "读取下载存档失败：%s", path)
+	}
+	return a, nil
+}
+
+// Has 判断源视频地址是否已经下载过
+func (a *Archive) Has(originUrl string) bool {
+	_, ok := a.Get(originUrl)
+	return ok
+}
+
+// Get 获取源视频地址对应的下载记录
+func (a *Archive) Get(originUrl string) (Record, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.records[Normalize(originUrl)]
+	return r, ok
+}
+
+// Add 记录一个下载成功的任务, 文件大小从磁盘读取
+// @param duration 输出文件的时长, 未知时传 0
+func (a *Archive) Add(originUrl, path string, duration time.Duration) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "读取文件信息失败：%s", path)
+	}
+	r := Record{Url: Normalize(originUrl), Path: path, Size: stat.Size(), Time: time.Now(), Duration: duration}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "序列化下载记录失败")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err = os.MkdirAll(filepath.Dir(a.path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "创建下载存档目录失败：%s", a.path)
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "打开下载存档失败：%s", a.path)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "写入下载存档失败：%s", a.path)
+	}
+	a.records[r.Url] = r
+	return nil
+}
+
+// List 返回所有的下载记录, 按照下载完成时间升序排列
+func (a *Archive) List() []Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ans := make([]Record, 0, len(a.records))
+	for _, r := range a.records {
+		ans = append(ans, r)
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		if ans[i].Time.Equal(ans[j].Time) {
+			return ans[i].Url < ans[j].Url
+		}
+		return ans[i].Time.Before(ans[j].Time)
+	})
+	return ans
+}
+
+// Prune 删除 remove 返回 true 的记录, 并重写存档文件
+//
+// 重写时会合并同一地址的重复记录
+// @return 删除的记录数
+func (a *Archive) Prune(remove func(r Record) bool) (int, error) {
+	kept := []Record{}
+	for _, r := range a.List() {
+		if !remove(r) {
+			kept = append(kept, r)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	removed := len(a.records) - len(kept)
+	if err := a.rewrite(kept); err != nil {
+		return 0, err
+	}
+	a.records = make(map[string]Record, len(kept))
+	for _, r := range kept {
+		a.records[r.Url] = r
+	}
+	return removed, nil
+}
+
+// rewrite 先写入临时文件再替换, 避免中途失败导致存档损坏
+//
+// 调用方需要持有锁
+func (a *Archive) rewrite(records []Record) error {
+	if err := os.MkdirAll(filepath.Dir(a.path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "创建下载存档目录失败：%s", a.path)
+	}
+	tmpPath := a.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrapf(err, "创建临时文件失败：%s", tmpPath)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "重写下载存档失败：%s", a.path)
+	}
+	return errors.Wrapf(os.Rename(tmpPath, a.path), "替换下载存档失败：%s", a.path)
+}
+
+// trackingParams 不影响资源内容的统计参数, 规范化时去除
+var trackingParams = []string{"spm", "spm_id_from", "vd_source", "share_source", "share_medium", "fbclid", "gclid"}
+
+// Normalize 规范化源视频地址, 使同一个资源的不同写法对应同一条记录
+//
+// 协议和域名转为小写, 去除默认端口、锚点、统计参数和路径末尾的 /, 查询参数按名称排序
+// 以 / 或 ! 开头的锚点是前端路由 (如 #/video/1, #!/video/1), 决定了访问的是哪个视频, 需要保留
+func Normalize(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return rawUrl
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 地址需要保留方括号
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = host + ":" + port
+	}
+
+	if !isRouteFragment(u.Fragment) {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	for _, key := range trackingParams {
+		query.Del(key)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// isRouteFragment 判断锚点是否为前端路由
+func isRouteFragment(fragment string) bool {
+	return strings.HasPrefix(fragment, "/") || strings.HasPrefix(fragment, "!")
+}
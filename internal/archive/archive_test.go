@@ -0,0 +1,75 @@
+package archive_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"video-downloader-go/internal/archive"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"HTTPS://Www.Example.com:443/video/1/?b=2&a=1#t=10":         "https://www.example.com/video/1?a=1&b=2",
+		"https://www.bilibili.com/video/BV1xx/?spm_id_from=333&p=2": "https://www.bilibili.com/video/BV1xx?p=2",
+		"http://example.com:8080/a?utm_source=x":                    "http://example.com:8080/a",
+		"http://[::1]:80/a":                                         "http://[::1]/a",
+		"not a url":                                                 "not a url",
+		"https://site.com/#/video/1":                                "https://site.com/#/video/1",
+		"https://site.com/?spm=1#!/video/2":                         "https://site.com/#!/video/2",
+	}
+	for in, want := range cases {
+		if got := archive.Normalize(in); got != want {
+			t.Errorf("规范化结果异常, input: %s, got: %s, want: %s", in, got, want)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "archive.jsonl")
+	a, err := archive.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file1, file2 := filepath.Join(dir, "1.mp4"), filepath.Join(dir, "2.mp4")
+	os.WriteFile(file1, []byte("123"), 0644)
+	os.WriteFile(file2, []byte("45"), 0644)
+	if err = a.Add("https://example.com/1#x", file1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Add("https://example.com/2", file2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Has("https://EXAMPLE.com/1/") {
+		t.Fatal("同一个资源的不同写法应该命中存档")
+	}
+
+	// 重新读取
+	a, err = archive.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := a.Get("https://example.com/1")
+	if !ok || r.Size != 3 || r.Path != file1 || r.Duration != time.Minute {
+		t.Fatalf("读取存档异常: %+v", r)
+	}
+	if len(a.List()) != 2 {
+		t.Fatalf("记录数异常: %d", len(a.List()))
+	}
+
+	// 清理文件已经不存在的记录
+	os.Remove(file2)
+	removed, err := a.Prune(func(r archive.Record) bool {
+		_, err := os.Stat(r.Path)
+		return err != nil
+	})
+	if err != nil || removed != 1 {
+		t.Fatalf("清理存档异常, removed: %d, err: %v", removed, err)
+	}
+	a, _ = archive.Open(path)
+	if a.Has("https://example.com/2") || !a.Has("https://example.com/1") {
+		t.Fatal("清理后的存档内容异常")
+	}
+}
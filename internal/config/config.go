@@ -15,17 +15,30 @@ var FfmpegPath string
 var YoutubeDlPath string
 
 type Config struct {
-	Downloader Downloader     `yaml:"downloader"` // 下载器
-	Transfer   Transfer       `yaml:"transfer"`   // 转换器
-	Decoder    Decoder        `yaml:"decoder"`    // 解析器
-	Customs    []CustomConfig `yaml:"customs"`    // 定制化配置
+	Downloader     Downloader      `yaml:"downloader"`      // 下载器
+	Transfer       Transfer        `yaml:"transfer"`        // 转换器
+	Decoder        Decoder         `yaml:"decoder"`         // 解析器
+	PostProcessors []PostProcessor `yaml:"post-processors"` // 后处理器, 按顺序执行
+	Customs        []CustomConfig  `yaml:"customs"`         // 定制化配置
+	HeaderRules    []HeaderRule    `yaml:"header-rules"`    // 请求头规则
+	Proxy          Proxy           `yaml:"proxy"`           // 代理
 }
 
 // 全局配置对象
 var G = &Config{}
 
-// 全局加载配置
+// 全局加载配置, 并准备运行环境
 func Load(configFilePath string) error {
+	return load(configFilePath, true)
+}
+
+// LoadWithoutEnv 全局加载配置, 不下载依赖也不检查运行环境, 用于只需要读取配置的命令
+func LoadWithoutEnv(configFilePath string) error {
+	return load(configFilePath, false)
+}
+
+// load 全局加载配置, prepareEnv 为 true 时下载依赖并检查运行环境
+func load(configFilePath string, prepareEnv bool) error {
 	if configFilePath = strings.TrimSpace(configFilePath); len(configFilePath) == 0 {
 		configFilePath = "config/config.yml"
 	}
@@ -41,28 +54,53 @@ func Load(configFilePath string) error {
 		return errors.Wrap(err, "读取配置文件失败")
 	}
 
-	// 3 读取依赖路径
-	readDependencyPaths()
+	// 3 检查代理配置, 自动下载依赖时同样需要使用代理
+	if err = checkProxyConfig(); err != nil {
+		return errors.Wrap(err, "代理配置异常")
+	}
+
+	// 4 读取依赖路径
+	if prepareEnv {
+		readDependencyPaths()
+	}
 
-	// 4 检查下载器配置
+	// 5 检查下载器配置
 	if err = checkDownloaderConfig(); err != nil {
 		return errors.Wrap(err, "下载器配置异常")
 	}
 
-	// 5 检查转换器配置
+	// 6 检查转换器配置
 	if err = checkTransferConfig(); err != nil {
 		return errors.Wrap(err, "转换器配置异常")
 	}
+	if prepareEnv {
+		increaseSystemUlimit(65535)
+	}
 
-	// 6 检查解析器配置
+	// 7 检查解析器配置
 	if err = checkDecoderConfig(); err != nil {
 		return errors.Wrap(err, "解析器配置异常")
 	}
+	if prepareEnv {
+		if err = checkYtDlEnv(); err != nil {
+			return errors.Wrap(err, "检查 youtube-dl 环境失败")
+		}
+	}
+
+	// 8 检查后处理器配置
+	if err = checkPostProcessConfig(); err != nil {
+		return errors.Wrap(err, "后处理器配置异常")
+	}
 
-	// 7 检查定制化配置
+	// 9 检查定制化配置
 	if err = checkCustomConfig(); err != nil {
 		return errors.Wrap(err, "定制化配置异常")
 	}
+
+	// 10 检查请求头规则
+	if err = checkHeaderRulesConfig(); err != nil {
+		return errors.Wrap(err, "请求头规则配置异常")
+	}
 	return nil
 }
 
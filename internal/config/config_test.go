@@ -4,6 +4,7 @@ import (
 	"log"
 	"testing"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 )
 
 func load() error {
@@ -29,7 +30,8 @@ func TestCustoms(t *testing.T) {
 		ccf := config.G.Decoder.YoutubeDL.CustomCookiesFrom(dcUrl)
 		cfc := config.G.Decoder.YoutubeDL.CustomFormatCodes(dcUrl)
 		crf := config.G.Decoder.YoutubeDL.CustomRememberFormat(dcUrl)
-		log.Printf("dcUrl: %v, use: %v, cookies-from: %v, format-codes: %v, remember-format: %v\n", dcUrl, cu, ccf, cfc, crf)
+		chain := config.G.Decoder.CustomChain(dcUrl)
+		log.Printf("dcUrl: %v, use: %v, cookies-from: %v, format-codes: %v, remember-format: %v, chain: %v\n", dcUrl, cu, ccf, cfc, crf, chain)
 	}
 
 	execFunc("http://example.com/a.mp4")
@@ -4,53 +4,123 @@ package config
 
 import (
 	"net/url"
+	"sort"
 	"strings"
+	"video-downloader-go/internal/util/mysemaphore"
+	"video-downloader-go/internal/util/mytokenbucket"
 
 	"github.com/pkg/errors"
 )
 
 type CustomConfig struct {
-	Decoder  Decoder  `yaml:"decoder"`  // 解析器配置
-	Transfer Transfer `yaml:"transfer"` // 转换器配置
-	Hosts    []string `yaml:"hosts"`    // 指定的域名列表
+	Decoder        Decoder         `yaml:"decoder"`         // 解析器配置
+	Downloader     Downloader      `yaml:"downloader"`      // 下载器配置
+	Transfer       Transfer        `yaml:"transfer"`        // 转换器配置
+	PostProcessors []PostProcessor `yaml:"post-processors"` // 后处理器配置
+	Proxy          Proxy           `yaml:"proxy"`           // 代理配置
+	Hosts          []string        `yaml:"hosts"`           // 指定的域名列表
 }
 
-// host2Decoder 保存每个 host 的定制化解析器配置
-var host2Decoder map[string]*Decoder
+// customRule 一条定制化配置的匹配规则
+type customRule struct {
+	*HostRule
+	index  int           // 定制化配置在 customs 中的下标
+	custom *CustomConfig // 规则所属的定制化配置
+}
 
-// host2Transfer 保存每个 host 的定制化转换器配置
-var host2Transfer map[string]*Transfer
+// customRules 所有定制化配置的匹配规则, 按照优先级从高到低排列
+var customRules []customRule
 
 // checkCustomConfig 执行定制化配置的初始化
 func checkCustomConfig() error {
-	host2Decoder = make(map[string]*Decoder)
-	host2Transfer = make(map[string]*Transfer)
+	customRules = nil
 	customs := G.Customs
 
-	for i, custom := range customs {
-		copyCustom := custom
+	for i := range customs {
+		custom := &customs[i]
 
 		// 1 检查解析器配置
-		if err := copyCustom.Decoder.checkFields(true); err != nil {
+		if err := custom.Decoder.checkFields(true); err != nil {
 			return errors.Wrapf(err, "请检查定制化的解析器配置, index: %v", i)
 		}
 
 		// 2 检查转换器配置
-		if err := copyCustom.Transfer.checkFields(true); err != nil {
+		if err := custom.Transfer.checkFields(true); err != nil {
 			return errors.Wrapf(err, "请检查定制化的解析器配置, index: %v", i)
 		}
 
-		// 3 保存 host 映射
-		for _, host := range copyCustom.Hosts {
-			h := strings.TrimSpace(host)
-			if h == "" {
+		// 3 检查后处理器配置
+		if err := checkPostProcessors(custom.PostProcessors); err != nil {
+			return errors.Wrapf(err, "请检查定制化的后处理器配置, index: %v", i)
+		}
+
+		// 4 检查下载器配置
+		if err := custom.Downloader.checkCustomFields(); err != nil {
+			return errors.Wrapf(err, "请检查定制化的下载器配置, index: %v", i)
+		}
+
+		// 5 检查代理配置, 没有配置 no-proxy 时使用全局配置的 no-proxy
+		if err := custom.Proxy.checkFields(true); err != nil {
+			return errors.Wrapf(err, "请检查定制化的代理配置, index: %v", i)
+		}
+		if len(custom.Proxy.NoProxy) == 0 {
+			custom.Proxy.NoProxy = G.Proxy.NoProxy
+			custom.Proxy.noAll, custom.Proxy.noHosts, custom.Proxy.noNets = G.Proxy.noAll, G.Proxy.noHosts, G.Proxy.noNets
+		}
+
+		// 6 解析匹配规则
+		for _, host := range custom.Hosts {
+			if strings.TrimSpace(host) == "" {
 				continue
 			}
-			host2Decoder[h] = &copyCustom.Decoder
-			host2Transfer[h] = &copyCustom.Transfer
+			rule, err := ParseHostRule(host)
+			if err != nil {
+				return errors.Wrapf(err, "请检查定制化配置的 hosts, index: %v", i)
+			}
+			customRules = append(customRules, customRule{HostRule: rule, index: i, custom: custom})
 		}
 	}
 
+	// 优先级相同时, 配置在前面的规则优先
+	sort.SliceStable(customRules, func(a, b int) bool {
+		return customRules[a].MoreSpecific(customRules[b].HostRule)
+	})
+	return nil
+}
+
+// CustomMatch 源视频地址匹配到的一条定制化配置规则
+type CustomMatch struct {
+	Index   int          // 定制化配置在 customs 中的下标
+	Pattern string       // 匹配到的规则
+	Kind    HostRuleKind // 规则类型
+}
+
+// ExplainCustoms 返回源视频地址匹配到的所有定制化配置规则, 按照优先级从高到低排列, 只有第一条规则生效
+func ExplainCustoms(rawUrl string) []CustomMatch {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+	var ans []CustomMatch
+	for _, r := range customRules {
+		if r.Match(u) {
+			ans = append(ans, CustomMatch{Index: r.index, Pattern: r.Pattern, Kind: r.Kind})
+		}
+	}
+	return ans
+}
+
+// resolveCustomByUrl 返回源视频地址生效的定制化配置, 没有匹配的配置时返回 nil
+func resolveCustomByUrl(rawUrl string) *CustomConfig {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+	for _, r := range customRules {
+		if r.Match(u) {
+			return r.custom
+		}
+	}
 	return nil
 }
 
@@ -76,6 +146,26 @@ func (dc *Decoder) CustomMaxRetry(dcUrl string) int {
 	return targetDecoder.MaxRetry
 }
 
+// CustomChain 返回按照顺序尝试的解析器链, 第一个为 use, 之后为 fallbacks
+// 优先返回定制化配置, 定制化配置没有配置 use 时使用全局配置的解析器链
+func (dc *Decoder) CustomChain(dcUrl string) []DecoderStep {
+	targetDecoder := resolveDecoderByUrl(dcUrl, dc)
+	if targetDecoder == nil || targetDecoder.Use == "" {
+		targetDecoder = dc
+	}
+
+	maxRetry := dc.CustomMaxRetry(dcUrl)
+	chain := make([]DecoderStep, 0, len(targetDecoder.Fallbacks)+1)
+	chain = append(chain, DecoderStep{Use: targetDecoder.Use, MaxRetry: maxRetry})
+	for _, step := range targetDecoder.Fallbacks {
+		if step.MaxRetry < 1 {
+			step.MaxRetry = maxRetry
+		}
+		chain = append(chain, step)
+	}
+	return chain
+}
+
 // CustomCookiesFrom 返回一个 youtube-dl 的 cookie 来源
 // 优先返回定制化配置
 func (y *YoutubeDlConfig) CustomCookiesFrom(dcUrl string) string {
@@ -117,6 +207,19 @@ func (c *CatCatchConfig) CustomHeadless(dcUrl string) int {
 	return targetDecoder.CatCatch.Headless
 }
 
+// CustomExec 返回指定名称的外部进程解析器配置
+// 优先返回定制化配置
+func (dc *Decoder) CustomExec(dcUrl, name string) (ExecDecoderConfig, bool) {
+	targetDecoder := resolveDecoderByUrl(dcUrl, dc)
+	if targetDecoder != nil {
+		if ec, ok := targetDecoder.Exec[name]; ok {
+			return ec, true
+		}
+	}
+	ec, ok := dc.Exec[name]
+	return ec, ok
+}
+
 // resolveDecoderByUrl 根据解析 url 返回解析器
 // 优先返回定制化配置解析器
 func resolveDecoderByUrl(dcUrl string, defaultDecoder *Decoder) *Decoder {
@@ -125,15 +228,9 @@ func resolveDecoderByUrl(dcUrl string, defaultDecoder *Decoder) *Decoder {
 		defaultDecoder = &G.Decoder
 	}
 
-	u, err := url.Parse(dcUrl)
-	if err != nil {
-		// 解析 url 异常
-		return defaultDecoder
-	}
-
-	if target, ok := host2Decoder[u.Host]; ok {
+	if target := resolveCustomByUrl(dcUrl); target != nil {
 		// 成功找到匹配的定制化解析器配置
-		return target
+		return &target.Decoder
 	}
 
 	return defaultDecoder
@@ -148,6 +245,15 @@ func (t *Transfer) CustomUse(originUrl string) string {
 	return targetTransfer.Use
 }
 
+// CustomContainer 优先使用定制化的输出容器
+func (t *Transfer) CustomContainer(originUrl string) string {
+	targetTransfer := resolveTransferByUrl(originUrl, nil)
+	if targetTransfer == nil || targetTransfer.Container == "" {
+		return t.Container
+	}
+	return targetTransfer.Container
+}
+
 // resolveTransferByUrl 根据解析 url 返回解析器
 // 优先返回定制化配置解析器
 func resolveTransferByUrl(originUrl string, defaultTransfer *Transfer) *Transfer {
@@ -156,16 +262,138 @@ func resolveTransferByUrl(originUrl string, defaultTransfer *Transfer) *Transfer
 		defaultTransfer = &G.Transfer
 	}
 
-	u, err := url.Parse(originUrl)
-	if err != nil {
-		// 解析 url 异常
-		return defaultTransfer
-	}
-
-	if target, ok := host2Transfer[u.Host]; ok {
+	if target := resolveCustomByUrl(originUrl); target != nil {
 		// 成功找到匹配的定制化解析器配置
-		return target
+		return &target.Transfer
 	}
 
 	return defaultTransfer
 }
+
+// CustomUse 优先使用定制化的下载器类型
+func (d *Downloader) CustomUse(originUrl string) string {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.Use == "" {
+		return d.Use
+	}
+	return target.Use
+}
+
+// CustomDownloadDir 优先使用定制化的下载目录
+func (d *Downloader) CustomDownloadDir(originUrl string) string {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.DownloadDir == "" {
+		return d.DownloadDir
+	}
+	return target.DownloadDir
+}
+
+// CustomTsDirSuffix 优先使用定制化的临时 ts 目录后缀
+func (d *Downloader) CustomTsDirSuffix(originUrl string) string {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.TsDirSuffix == "" {
+		return d.TsDirSuffix
+	}
+	return target.TsDirSuffix
+}
+
+// CustomVerify 优先使用定制化的下载完成后是否校验文件
+func (d *Downloader) CustomVerify(originUrl string) int {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.Verify == 0 {
+		return d.Verify
+	}
+	return target.Verify
+}
+
+// CustomFilenameTemplate 优先使用定制化的输出文件名模板
+func (d *Downloader) CustomFilenameTemplate(originUrl string) string {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.FilenameTemplate == "" {
+		return d.FilenameTemplate
+	}
+	return target.FilenameTemplate
+}
+
+// CustomExistPolicy 优先使用定制化的文件已存在时的处理策略
+func (d *Downloader) CustomExistPolicy(originUrl string) string {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.ExistPolicy == "" {
+		return d.ExistPolicy
+	}
+	return target.ExistPolicy
+}
+
+// CustomMaxRetry 优先使用定制化的下载最大尝试次数
+func (d *Downloader) CustomMaxRetry(originUrl string) int {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.MaxRetry < 1 {
+		return d.MaxRetry
+	}
+	return target.MaxRetry
+}
+
+// CustomDlThreadCount 优先使用定制化的分片下载线程数
+func (d *Downloader) CustomDlThreadCount(originUrl string) int {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.DlThreadCount <= 0 {
+		return d.DlThreadCount
+	}
+	return target.DlThreadCount
+}
+
+// CustomHTTP2 优先使用定制化的是否使用 HTTP/2
+func (d *Downloader) CustomHTTP2(originUrl string) bool {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.HTTP2 == 0 {
+		return d.HTTP2 != DownloadHTTP2Deactive
+	}
+	return target.HTTP2 == DownloadHTTP2Active
+}
+
+// CustomBucket 返回下载时使用的令牌桶
+// 定制化配置了 rate-limit 时使用独立的令牌桶, 不受全局速率限制
+func (d *Downloader) CustomBucket(originUrl string) *mytokenbucket.MyTokenBucket {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.bucket == nil {
+		return mytokenbucket.GlobalBucket
+	}
+	return target.bucket
+}
+
+// CustomLimiter 返回限制同时下载的分片数的信号量, 配置没有加载时返回 nil
+// 同一个定制化配置匹配的所有任务共用一个信号量, 没有配置 dl-thread-count 时与全局配置共用
+func (d *Downloader) CustomLimiter(originUrl string) *mysemaphore.Semaphore {
+	target := resolveDownloaderByUrl(originUrl, d)
+	if target.limiter == nil {
+		return d.limiter
+	}
+	return target.limiter
+}
+
+// resolveDownloaderByUrl 根据源视频地址返回下载器配置
+// 优先返回定制化配置
+func resolveDownloaderByUrl(originUrl string, defaultDownloader *Downloader) *Downloader {
+	if target := resolveCustomByUrl(originUrl); target != nil {
+		return &target.Downloader
+	}
+	return defaultDownloader
+}
+
+// resolvePostProcessorsByUrl 根据源视频地址返回定制化的后处理器列表
+// 没有定制化配置时返回 nil
+func resolvePostProcessorsByUrl(originUrl string) []PostProcessor {
+	if target := resolveCustomByUrl(originUrl); target != nil {
+		return target.PostProcessors
+	}
+	return nil
+}
+
+// CustomProxy 返回源视频地址对应的代理配置
+// 优先返回定制化配置, 定制化配置没有配置 url 时使用全局配置
+func (p *Proxy) CustomProxy(originUrl string) *Proxy {
+	if custom := resolveCustomByUrl(originUrl); custom != nil && custom.Proxy.Enabled() {
+		return &custom.Proxy
+	}
+	return p
+}
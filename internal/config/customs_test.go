@@ -0,0 +1,73 @@
+package config_test
+
+import (
+	"testing"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/util/mytokenbucket"
+)
+
+func TestCustomDownloader(t *testing.T) {
+	loadYaml(t, `
+customs:
+  - downloader:
+      use: simple
+      dl-thread-count: 4
+      download-dir: /tmp/cdn
+      rate-limit: 2mbps
+      filename-template: "{host}/{name}"
+      max-retry: 9
+      http2: -1
+    hosts:
+      - .slow-cdn.com
+  - downloader:
+      exist-policy: invalid
+      task-thread-count: 3
+    hosts:
+      - other.com
+`)
+	dl := &config.G.Downloader
+	custom, other, global := "https://a.slow-cdn.com/v.mp4", "https://other.com/v.mp4", "https://example.com/v.mp4"
+
+	if dl.CustomUse(custom) != config.DownloadSimple || dl.CustomUse(global) != dl.Use {
+		t.Fatalf("下载器类型异常: %s, %s", dl.CustomUse(custom), dl.CustomUse(global))
+	}
+	if dl.CustomDownloadDir(custom) != "/tmp/cdn" || dl.CustomMaxRetry(custom) != 9 {
+		t.Fatalf("定制化配置没有生效: %s, %d", dl.CustomDownloadDir(custom), dl.CustomMaxRetry(custom))
+	}
+	if got := dl.CustomFilenameTemplate(custom); got != "{host}/{name}.{ext}" {
+		t.Fatalf("文件名模板没有补全容器后缀: %s", got)
+	}
+
+	// 没有配置或配置错误的属性使用全局配置
+	if dl.CustomExistPolicy(other) != dl.ExistPolicy || dl.CustomTsDirSuffix(custom) != dl.TsDirSuffix || dl.CustomVerify(custom) != dl.Verify {
+		t.Fatal("没有配置的属性应该使用全局配置")
+	}
+	if dl.CustomDownloadDir(other) != dl.DownloadDir || dl.CustomMaxRetry(global) != dl.MaxRetry {
+		t.Fatal("没有配置的属性应该使用全局配置")
+	}
+
+	// 限速和分片数限制
+	if b := dl.CustomBucket(custom); b == nil || b == mytokenbucket.GlobalBucket {
+		t.Fatal("配置了 rate-limit 时应该使用独立的令牌桶")
+	}
+	if dl.CustomBucket(other) != mytokenbucket.GlobalBucket {
+		t.Fatal("没有配置 rate-limit 时应该使用全局令牌桶")
+	}
+	if l := dl.CustomLimiter(custom); l == nil || l == dl.CustomLimiter(global) || l.Free() != 4 {
+		t.Fatal("配置了 dl-thread-count 时应该使用独立的分片数限制")
+	}
+	if dl.CustomLimiter(other) != dl.CustomLimiter(global) {
+		t.Fatal("没有配置 dl-thread-count 时应该与全局配置共用分片数限制")
+	}
+	if got := dl.DlPoolSize(); got != 12 {
+		t.Fatalf("协程池大小异常: %d", got)
+	}
+
+	// 连接池
+	if dl.CustomDlThreadCount(custom) != 4 || dl.CustomDlThreadCount(other) != dl.DlThreadCount {
+		t.Fatalf("分片下载线程数异常: %d, %d", dl.CustomDlThreadCount(custom), dl.CustomDlThreadCount(other))
+	}
+	if dl.CustomHTTP2(custom) || !dl.CustomHTTP2(other) {
+		t.Fatal("定制化配置的 http2 没有生效")
+	}
+}
@@ -2,7 +2,6 @@
 package config
 
 import (
-	"fmt"
 	"os/exec"
 	"slices"
 	"strings"
@@ -11,13 +10,59 @@ import (
 	"github.com/pkg/errors"
 )
 
-const (
-	DecoderNone       = "none"
-	DecoderYoutubeDl  = "youtube-dl"
-	DecoderCatCatchTx = "cat-catch:tx"
-	DecoderCatCatchMg = "cat-catch:mg"
+// DecoderNone 不解析, 直接使用源视频地址下载, 是唯一内置的解析器类型
+//
+// 其他解析器类型由各自的包在 init 中通过 decoder.Register 注册
+const DecoderNone = "none"
+
+// DecoderFamilySuffix 以该后缀结尾的解析器类型表示一组解析器, 如 exec:* 匹配 exec:foo, exec:bar
+const DecoderFamilySuffix = "*"
+
+// DecoderCheck 校验解析器自身的配置, 全局配置和定制化配置都会调用
+//
+// allowEmpty 为 true 时 (定制化配置), 对于空值不进行校验, 也不返回错误
+type DecoderCheck func(dc *Decoder, allowEmpty bool) error
+
+var (
+	decoderTypes  = []string{DecoderNone}     // 已注册的解析器类型, 按照注册顺序排列
+	decoderChecks = map[string]DecoderCheck{} // 解析器类型 => 配置校验函数
 )
 
+// RegisterDecoder 登记一个解析器类型及其配置校验函数, check 可以为空
+//
+// 类型以 DecoderFamilySuffix 结尾时登记的是一组解析器,
+// 由 decoder.Register 调用, 只能在 init 中调用, 类型重复时 panic
+func RegisterDecoder(name string, check DecoderCheck) {
+	if slices.Contains(decoderTypes, name) {
+		panic("重复注册的解析器类型：" + name)
+	}
+	decoderTypes = append(decoderTypes, name)
+	if check != nil {
+		decoderChecks[name] = check
+	}
+}
+
+// DecoderTypes 返回所有已注册的解析器类型
+func DecoderTypes() []string {
+	return slices.Clone(decoderTypes)
+}
+
+// DecoderTypeOf 返回解析器类型匹配的已注册类型, 未注册时返回空串
+//
+// 优先精确匹配, 其次匹配一组解析器, 如 exec:foo 匹配 exec:*
+func DecoderTypeOf(use string) string {
+	if slices.Contains(decoderTypes, use) {
+		return use
+	}
+	for _, t := range decoderTypes {
+		prefix, ok := strings.CutSuffix(t, DecoderFamilySuffix)
+		if ok && len(use) > len(prefix) && strings.HasPrefix(use, prefix) {
+			return t
+		}
+	}
+	return ""
+}
+
 const (
 	ResourceMP4  = "mp4"
 	ResourceM3U8 = "m3u8"
@@ -34,10 +79,28 @@ const (
 )
 
 type Decoder struct {
-	Use       string          `yaml:"use"`        // 使用哪种解析方式，可选值：none, youtube-dl, cat-catch:tx, cat-catch:mg
-	MaxRetry  int             `yaml:"max-retry"`  // 最大的尝试解析次数
-	YoutubeDL YoutubeDlConfig `yaml:"youtube-dl"` // youtube-dl 解析器相关配置
-	CatCatch  CatCatchConfig  `yaml:"cat-catch"`  // cat-catch 解析器
+	Use        string                       `yaml:"use"`         // 使用哪种解析方式，可选值：none, youtube-dl, cat-catch:tx, cat-catch:mg
+	MaxRetry   int                          `yaml:"max-retry"`   // 最大的尝试解析次数
+	Fallbacks  []DecoderStep                `yaml:"fallbacks"`   // use 解析失败后按顺序尝试的解析器
+	Prefetch   int                          `yaml:"prefetch"`    // 预先解析好等待下载的任务个数, 仅全局配置有效
+	Workers    int                          `yaml:"workers"`     // 同时进行解析的任务个数, 仅全局配置有效
+	UseWorkers map[string]int               `yaml:"use-workers"` // 每种解析器同时进行解析的任务个数, 没有配置的解析器只受 workers 限制, 仅全局配置有效
+	YoutubeDL  YoutubeDlConfig              `yaml:"youtube-dl"`  // youtube-dl 解析器相关配置
+	CatCatch   CatCatchConfig               `yaml:"cat-catch"`   // cat-catch 解析器
+	Exec       map[string]ExecDecoderConfig `yaml:"exec"`        // 外部进程解析器, 名称 => 配置, 使用时配置 use 为 exec:名称
+}
+
+// DecoderStep 解析器链中的一个解析器
+type DecoderStep struct {
+	Use      string `yaml:"use"`       // 解析器类型
+	MaxRetry int    `yaml:"max-retry"` // 最大的尝试解析次数, 没有配置时使用 max-retry
+}
+
+// ExecDecoderConfig 外部进程解析器配置
+type ExecDecoderConfig struct {
+	Command []string       `yaml:"command"` // 要执行的命令及参数
+	Timeout int            `yaml:"timeout"` // 单次解析的超时时间, 单位: 秒
+	Options map[string]any `yaml:"options"` // 站点配置, 原样传递给外部进程
 }
 
 type YoutubeDlConfig struct {
@@ -75,12 +138,11 @@ func checkDecoderConfig() error {
 	if err := cfg.checkFields(false); err != nil {
 		return errors.Wrap(err, "解析器配置异常")
 	}
-
-	// 检查 youtube-dl 环境
-	if err := checkYtDlEnv(); err != nil {
-		return errors.Wrap(err, "检查 youtube-dl 环境失败")
+	if cfg.Prefetch < 1 {
+		mylog.Warn("没有配置预先解析的任务个数或配置错误，使用默认值：2")
+		cfg.Prefetch = 2
 	}
-
+	cfg.checkWorkers()
 	return nil
 }
 
@@ -89,7 +151,7 @@ func checkDecoderConfig() error {
 // allowEmpty 参数为 true 时，对于空值不进行校验，也不返回错误
 func (dc *Decoder) checkFields(allowEmpty bool) error {
 	// 1 检查解析器类型是否合法
-	validTypes := []string{DecoderNone, DecoderYoutubeDl, DecoderCatCatchTx, DecoderCatCatchMg}
+	validTypes := decoderTypes
 	dc.Use = strings.TrimSpace(dc.Use)
 
 	if dc.Use == "" && !allowEmpty {
@@ -99,7 +161,7 @@ func (dc *Decoder) checkFields(allowEmpty bool) error {
 	flag := false
 
 	if dc.Use != "" {
-		if slices.Contains(validTypes, dc.Use) {
+		if DecoderTypeOf(dc.Use) != "" {
 			flag = true
 		}
 		if !flag {
@@ -107,28 +169,34 @@ func (dc *Decoder) checkFields(allowEmpty bool) error {
 		}
 	}
 
-	// 3 检查 format code
-	if err := dc.checkFormatCodes(); err != nil {
-		return errors.Wrap(err, "检查 format code 失败")
+	// 2 检查备用解析器
+	for i := range dc.Fallbacks {
+		step := &dc.Fallbacks[i]
+		step.Use = strings.TrimSpace(step.Use)
+		if DecoderTypeOf(step.Use) == "" {
+			return errors.Errorf("备用解析器类型配置错误：%s，可选值：%s", step.Use, strings.Join(validTypes, ","))
+		}
+		if step.MaxRetry < 0 {
+			mylog.Warnf("备用解析器 %s 的最大尝试次数配置错误：%d，使用 max-retry 配置", step.Use, step.MaxRetry)
+			step.MaxRetry = 0
+		}
 	}
-
-	// 4 设置默认的 cookie 来源
-	dc.YoutubeDL.CookiesFrom = strings.TrimSpace(dc.YoutubeDL.CookiesFrom)
-	if dc.YoutubeDL.CookiesFrom == "" {
-		dc.YoutubeDL.CookiesFrom = YoutubeDlCookieNone
+	if len(dc.Fallbacks) > 0 && dc.Use == "" {
+		return errors.New("配置了备用解析器时必须配置 use")
 	}
 
-	// 5 检查 youtube-dl 记住视频格式配置
-	if !dc.YoutubeDL.IsRememberFormatValid() && !allowEmpty {
-		return errors.New("remember format 配置错误，可选值: -1, 1")
-	}
-
-	// 6 检查猫抓解析器配置
-	if !dc.CatCatch.IsHeadlessValid() && !allowEmpty {
-		return errors.New("headless 配置错误, 可选择: -1, 1")
+	// 3 检查每种解析器自身的配置
+	for _, name := range decoderTypes {
+		check, ok := decoderChecks[name]
+		if !ok {
+			continue
+		}
+		if err := check(dc, allowEmpty); err != nil {
+			return errors.Wrapf(err, "%s 解析器配置错误", name)
+		}
 	}
 
-	// 7 检查最大重试次数
+	// 4 检查最大重试次数
 	if dc.MaxRetry < 1 && !allowEmpty {
 		return errors.New("max-retry 配置错误, 必须大于 1")
 	}
@@ -136,6 +204,47 @@ func (dc *Decoder) checkFields(allowEmpty bool) error {
 	return nil
 }
 
+// checkWorkers 检查解析并发数配置, 配置错误时输出警告并使用默认值
+func (dc *Decoder) checkWorkers() {
+	if dc.Workers < 1 {
+		mylog.Warn("没有配置同时解析的任务个数或配置错误，使用默认值：1")
+		dc.Workers = 1
+	}
+
+	validTypes := decoderTypes
+	for use, n := range dc.UseWorkers {
+		if DecoderTypeOf(use) == "" {
+			mylog.Warnf("忽略未知解析器类型的并发数配置：%s，可选值：%s", use, strings.Join(validTypes, ","))
+			delete(dc.UseWorkers, use)
+			continue
+		}
+		if n < 1 {
+			mylog.Warnf("解析器 %s 的并发数配置错误：%d，只受全局并发数限制", use, n)
+			delete(dc.UseWorkers, use)
+		}
+	}
+}
+
+// Uses 返回配置中使用的所有解析器类型, 包括备用解析器
+func (dc *Decoder) Uses() []string {
+	uses := make([]string, 0, len(dc.Fallbacks)+1)
+	if dc.Use != "" {
+		uses = append(uses, dc.Use)
+	}
+	for _, step := range dc.Fallbacks {
+		uses = append(uses, step.Use)
+	}
+	return uses
+}
+
+// UseWorkersOf 返回指定解析器类型同时进行解析的任务上限
+func (dc *Decoder) UseWorkersOf(use string) int {
+	if n, ok := dc.UseWorkers[use]; ok {
+		return min(n, dc.Workers)
+	}
+	return dc.Workers
+}
+
 // IsHeadlessValid 检查用户配置的 headless 配置是否有效
 func (c *CatCatchConfig) IsHeadlessValid() bool {
 	valids := []int{CatCatchHeadlessActive, CatCatchHeadlessDeactive}
@@ -148,22 +257,6 @@ func (c *YoutubeDlConfig) IsRememberFormatValid() bool {
 	return slices.Contains(validRfs, c.RememberFormat)
 }
 
-// 检查 format code
-func (dc *Decoder) checkFormatCodes() error {
-	rawCodes := dc.YoutubeDL.RawFormatCodes
-
-	formatCodes := []*YtDlFormatCode{}
-	for _, raw := range rawCodes {
-		cs := strings.Split(raw, "+")
-		if len(cs) != 1 && len(cs) != 2 {
-			return errors.New(fmt.Sprintf("不合法的 format code：%v，示例：137+140", raw))
-		}
-		formatCodes = append(formatCodes, &YtDlFormatCode{raw, len(cs)})
-	}
-	dc.YoutubeDL.FormatCodes = formatCodes
-	return nil
-}
-
 // 检查 youtube-dl 环境
 func checkYtDlEnv() error {
 	cmd := exec.Command(YoutubeDlPath, "--help")
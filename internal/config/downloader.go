@@ -4,9 +4,12 @@ package config
 import (
 	"fmt"
 	"math"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"video-downloader-go/internal/util/mylog"
+	"video-downloader-go/internal/util/mysemaphore"
 	"video-downloader-go/internal/util/mytokenbucket"
 
 	"github.com/pkg/errors"
@@ -19,6 +22,24 @@ type Downloader struct {
 	DownloadDir     string `yaml:"download-dir"`      // 视频文件下载位置
 	TsDirSuffix     string `yaml:"ts-dir-suffix"`     // 暂存 ts 文件的目录后缀
 	RateLimit       string `yaml:"rate-limit"`        // 下载限速，两种单位可选：mbps，kbps，-1 则不限速
+	Verify          int    `yaml:"verify"`            // 是否在下载完成后校验视频文件，可选值：-1, 1
+
+	// 输出文件名模板，相对于下载目录，使用 / 分隔子目录
+	// 可用变量：{name}, {ext}, {host}, {date} 以及解析器提供的变量：{title}, {quality}（youtube-dl、猫抓、exec），{series}, {season}（仅 exec）
+	FilenameTemplate string `yaml:"filename-template"`
+
+	// 输出文件已存在时的处理策略，可选值：skip, overwrite, rename, skip-if-verified
+	ExistPolicy string `yaml:"exist-policy"`
+
+	// 下载失败时最多尝试的次数，包括下载地址失效后重新解析的次数，超过后任务失败
+	MaxRetry int `yaml:"max-retry"`
+
+	// 是否在服务器支持时使用 HTTP/2, 可选值：-1, 1
+	// 部分 CDN 对单个连接限速, 此时关闭 HTTP/2 使用多个 HTTP/1.1 连接下载更快
+	HTTP2 int `yaml:"http2"`
+
+	bucket  *mytokenbucket.MyTokenBucket // 定制化配置了 rate-limit 时使用的令牌桶, 全局配置使用 mytokenbucket.GlobalBucket
+	limiter *mysemaphore.Semaphore       // 限制同时下载的分片数, 由 dl-thread-count 决定
 }
 
 const (
@@ -26,6 +47,26 @@ const (
 	DownloadMultiThread = "multi-thread" // 多线程下载
 )
 
+// 默认的输出文件名模板
+const DefaultFilenameTemplate = "{name}.{ext}"
+
+const (
+	ExistPolicySkip           = "skip"             // 跳过下载
+	ExistPolicyOverwrite      = "overwrite"        // 清空已有文件后重新下载
+	ExistPolicyRename         = "rename"           // 在文件名后追加序号, 下载到新文件中
+	ExistPolicySkipIfVerified = "skip-if-verified" // 已有文件的大小或时长与下载源一致时跳过, 否则重新下载
+)
+
+const (
+	DownloadVerifyActive   = 1  // 下载完成后校验视频文件
+	DownloadVerifyDeactive = -1 // 下载完成后不校验视频文件
+)
+
+const (
+	DownloadHTTP2Active   = 1  // 服务器支持时使用 HTTP/2
+	DownloadHTTP2Deactive = -1 // 只使用 HTTP/1.1
+)
+
 const (
 	RateLimitMaxValueKBPS         = float64(math.MaxInt32) / 2 / 1024 // kbps 最大下载速率
 	RateLimitMinValueKBPS float64 = 1.0 * 10                          // kbps 最小下载速率
@@ -56,26 +97,138 @@ func checkDownloaderConfig() error {
 		mylog.Warn("没有配置临时 ts 目录后缀或配置错误，使用默认值：temp_ts_files")
 		cfg.TsDirSuffix = "temp_ts_files"
 	}
+	if cfg.Verify != DownloadVerifyActive && cfg.Verify != DownloadVerifyDeactive {
+		mylog.Warn("没有配置下载完成后是否校验文件或配置错误，使用默认值：1")
+		cfg.Verify = DownloadVerifyActive
+	}
+	if cfg.FilenameTemplate = strings.TrimSpace(cfg.FilenameTemplate); cfg.FilenameTemplate == "" {
+		cfg.FilenameTemplate = DefaultFilenameTemplate
+	}
+	var err error
+	if cfg.FilenameTemplate, err = checkFilenameTemplate(cfg.FilenameTemplate); err != nil {
+		return err
+	}
+	validPolicies := []string{ExistPolicySkip, ExistPolicyOverwrite, ExistPolicyRename, ExistPolicySkipIfVerified}
+	if cfg.ExistPolicy = strings.TrimSpace(cfg.ExistPolicy); !slices.Contains(validPolicies, cfg.ExistPolicy) {
+		mylog.Warn("没有配置文件已存在时的处理策略或配置错误，使用默认值：skip-if-verified")
+		cfg.ExistPolicy = ExistPolicySkipIfVerified
+	}
+	if cfg.MaxRetry < 1 {
+		mylog.Warn("没有配置下载最大尝试次数或配置错误，使用默认值：5")
+		cfg.MaxRetry = 5
+	}
+	if cfg.HTTP2 == 0 {
+		cfg.HTTP2 = DownloadHTTP2Active
+	} else if cfg.HTTP2 != DownloadHTTP2Active && cfg.HTTP2 != DownloadHTTP2Deactive {
+		mylog.Warnf("是否使用 HTTP/2 配置错误：%d，使用默认值：1", cfg.HTTP2)
+		cfg.HTTP2 = DownloadHTTP2Active
+	}
+	rate, err := parseRateLimit(cfg.RateLimit)
+	if err != nil {
+		return err
+	}
+	// 初始化令牌桶
+	tokenBucket, err := mytokenbucket.NewTokenBucket(int64(rate))
+	if err != nil {
+		return errors.Wrap(err, "初始化速率限制令牌桶时出现异常")
+	}
+	mytokenbucket.GlobalBucket = tokenBucket
+	cfg.limiter = mysemaphore.New(cfg.DlThreadCount)
+	return nil
+}
+
+// checkCustomFields 检查定制化的下载器配置, 没有配置的属性使用全局配置
+//
+// task-thread-count 只有全局配置有效, 配置错误的属性输出警告后忽略
+func (cfg *Downloader) checkCustomFields() error {
+	cfg.DownloadDir = strings.TrimSpace(cfg.DownloadDir)
+	if cfg.Use = strings.TrimSpace(cfg.Use); cfg.Use != "" && !downloadTypeValid(cfg.Use) {
+		mylog.Warnf("下载类型配置错误：%s，使用全局配置", cfg.Use)
+		cfg.Use = ""
+	}
+	if cfg.TaskThreadCount != 0 {
+		mylog.Warn("task-thread-count 只有全局配置有效，忽略定制化配置")
+		cfg.TaskThreadCount = 0
+	}
+	if cfg.DlThreadCount < 0 {
+		mylog.Warnf("下载线程数配置错误：%d，使用全局配置", cfg.DlThreadCount)
+		cfg.DlThreadCount = 0
+	}
+	cfg.TsDirSuffix = strings.TrimSpace(cfg.TsDirSuffix)
+	if cfg.Verify != 0 && cfg.Verify != DownloadVerifyActive && cfg.Verify != DownloadVerifyDeactive {
+		mylog.Warnf("下载完成后是否校验文件配置错误：%d，使用全局配置", cfg.Verify)
+		cfg.Verify = 0
+	}
+	if cfg.FilenameTemplate = strings.TrimSpace(cfg.FilenameTemplate); cfg.FilenameTemplate != "" {
+		var err error
+		if cfg.FilenameTemplate, err = checkFilenameTemplate(cfg.FilenameTemplate); err != nil {
+			return err
+		}
+	}
+	validPolicies := []string{ExistPolicySkip, ExistPolicyOverwrite, ExistPolicyRename, ExistPolicySkipIfVerified}
+	if cfg.ExistPolicy = strings.TrimSpace(cfg.ExistPolicy); cfg.ExistPolicy != "" && !slices.Contains(validPolicies, cfg.ExistPolicy) {
+		mylog.Warnf("文件已存在时的处理策略配置错误：%s，使用全局配置", cfg.ExistPolicy)
+		cfg.ExistPolicy = ""
+	}
+	if cfg.MaxRetry < 0 {
+		mylog.Warnf("下载最大尝试次数配置错误：%d，使用全局配置", cfg.MaxRetry)
+		cfg.MaxRetry = 0
+	}
+	if cfg.HTTP2 != 0 && cfg.HTTP2 != DownloadHTTP2Active && cfg.HTTP2 != DownloadHTTP2Deactive {
+		mylog.Warnf("是否使用 HTTP/2 配置错误：%d，使用全局配置", cfg.HTTP2)
+		cfg.HTTP2 = 0
+	}
+	if cfg.RateLimit = strings.TrimSpace(cfg.RateLimit); cfg.RateLimit != "" {
+		rate, err := parseRateLimit(cfg.RateLimit)
+		if err != nil {
+			return err
+		}
+		if cfg.bucket, err = mytokenbucket.NewTokenBucket(int64(rate)); err != nil {
+			return errors.Wrap(err, "初始化速率限制令牌桶时出现异常")
+		}
+	}
+	if cfg.DlThreadCount > 0 {
+		cfg.limiter = mysemaphore.New(cfg.DlThreadCount)
+	}
+	return nil
+}
+
+// checkFilenameTemplate 检查输出文件名模板, 返回补全容器后缀后的模板
+func checkFilenameTemplate(tpl string) (string, error) {
+	if filepath.IsAbs(tpl) || strings.HasPrefix(tpl, "/") {
+		return "", errors.New("文件名模板必须是相对于下载目录的路径")
+	}
+	if !strings.Contains(tpl, "{ext}") {
+		// 保证输出的文件总是带有容器后缀
+		tpl += ".{ext}"
+	}
+	return tpl, nil
+}
+
+// parseRateLimit 解析下载限速配置, 返回每秒下载的字节数
+//
+// 没有配置或者配置出错时使用默认的速率限制 5mbps
+func parseRateLimit(raw string) (float64, error) {
 	// 默认速率是 5mbps
 	var err error
 	var rate float64 = 5 * 1024 * 1024
 	kbps, mbps := "kbps", "mbps"
-	if cfg.RateLimit = strings.TrimSpace(cfg.RateLimit); cfg.RateLimit != "" {
-		if cfg.RateLimit == "-1" {
+	if raw = strings.TrimSpace(raw); raw != "" {
+		if raw == "-1" {
 			rate = RateLimitMaxValueMBPS * 1024 * 1024
-		} else if strings.HasSuffix(cfg.RateLimit, kbps) {
-			val := cfg.RateLimit[:len(cfg.RateLimit)-len(kbps)]
+		} else if strings.HasSuffix(raw, kbps) {
+			val := raw[:len(raw)-len(kbps)]
 			rate, err = checkKbpsRateLimit(val)
 			if err != nil {
-				return errors.Wrap(err, "检查下载器配置时出现异常")
+				return -1, errors.Wrap(err, "检查下载器配置时出现异常")
 			}
 			mylog.Successf("下载速率限制：%.1f%v", rate, kbps)
 			rate *= 1024
-		} else if strings.HasSuffix(cfg.RateLimit, mbps) {
-			val := cfg.RateLimit[:len(cfg.RateLimit)-len(mbps)]
+		} else if strings.HasSuffix(raw, mbps) {
+			val := raw[:len(raw)-len(mbps)]
 			rate, err = checkMbpsRateLimit(val)
 			if err != nil {
-				return errors.Wrap(err, "检查下载器配置时出现异常")
+				return -1, errors.Wrap(err, "检查下载器配置时出现异常")
 			}
 			mylog.Successf("下载速率限制：%.1f%v", rate, mbps)
 			rate *= 1024 * 1024
@@ -83,13 +236,19 @@ func checkDownloaderConfig() error {
 			mylog.Warn("没有配置限速或者配置出错，启用默认的速率限制：5mbps")
 		}
 	}
-	// 初始化令牌桶
-	tokenBucket, err := mytokenbucket.NewTokenBucket(int64(rate))
-	if err != nil {
-		return errors.Wrap(err, "初始化速率限制令牌桶时出现异常")
+	return rate, nil
+}
+
+// DlPoolSize 返回分片下载协程池的大小
+//
+// 全局配置和每个定制化配置的 dl-thread-count 分别限制各自任务的分片下载数,
+// 协程池的大小为它们的总和, 保证每组任务都可以达到各自的上限
+func (cfg *Downloader) DlPoolSize() int {
+	size := cfg.DlThreadCount
+	for _, custom := range G.Customs {
+		size += custom.Downloader.DlThreadCount
 	}
-	mytokenbucket.GlobalBucket = tokenBucket
-	return nil
+	return size
 }
 
 // 检查 kbps 速率是否合法
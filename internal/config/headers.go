@@ -0,0 +1,203 @@
+// 按照下载地址的域名补充请求头的规则
+
+package config
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
+)
+
+// HeaderRule 一条请求头规则, 对匹配的下载地址添加请求头和 cookie
+//
+// 作用于 m3u8 文件、ts 分片以及 mp4 的分段请求, 匹配的是下载地址而不是源视频地址
+type HeaderRule struct {
+	Hosts      []string          `yaml:"hosts"`       // 下载地址的匹配规则, 写法与定制化配置的 hosts 相同
+	Headers    map[string]string `yaml:"headers"`     // 要添加的请求头, 覆盖解析器提供的同名请求头
+	CookieFile string            `yaml:"cookie-file"` // Netscape 格式的 cookie 文件, 写入匹配的任务的 cookie jar 中
+	cookies    []fileCookie      // 从 cookie 文件中读取到的 cookie
+}
+
+// fileCookie cookie 文件中的一行记录
+type fileCookie struct {
+	domain     string    // 域名, 不包含开头的 .
+	subdomains bool      // 是否对子域名生效
+	path       string    // 路径前缀
+	secure     bool      // 是否只在 https 请求中发送
+	expireAt   time.Time // 过期时间, 零值表示会话 cookie
+	name       string
+	value      string
+}
+
+// headerRule 一条请求头规则的匹配规则
+type headerRule struct {
+	*HostRule
+	rule *HeaderRule // 匹配规则所属的请求头规则
+}
+
+// headerRules 所有请求头规则的匹配规则, 按照优先级从高到低排列
+var headerRules []headerRule
+
+// checkHeaderRulesConfig 检查请求头规则并读取 cookie 文件
+func checkHeaderRulesConfig() error {
+	headerRules = nil
+	for i := range G.HeaderRules {
+		hr := &G.HeaderRules[i]
+
+		// 1 统一请求头名称的格式, 避免与解析器提供的请求头大小写不同而重复发送
+		headers := make(map[string]string, len(hr.Headers))
+		for k, v := range hr.Headers {
+			if k = strings.TrimSpace(k); k == "" {
+				return errors.Errorf("请求头名称不能为空, index: %v", i)
+			}
+			headers[http.CanonicalHeaderKey(k)] = v
+		}
+		hr.Headers = headers
+
+		// 2 读取 cookie 文件
+		if hr.CookieFile = strings.TrimSpace(hr.CookieFile); hr.CookieFile != "" {
+			cookies, err := readCookieFile(hr.CookieFile)
+			if err != nil {
+				return errors.Wrapf(err, "请检查请求头规则的 cookie-file, index: %v", i)
+			}
+			hr.cookies = cookies
+		}
+		if len(hr.Headers) == 0 && hr.CookieFile == "" {
+			mylog.Warnf("请求头规则没有配置 headers 和 cookie-file，已忽略, index: %v", i)
+			continue
+		}
+
+		// 3 解析匹配规则
+		for _, host := range hr.Hosts {
+			if strings.TrimSpace(host) == "" {
+				continue
+			}
+			rule, err := ParseHostRule(host)
+			if err != nil {
+				return errors.Wrapf(err, "请检查请求头规则的 hosts, index: %v", i)
+			}
+			headerRules = append(headerRules, headerRule{HostRule: rule, rule: hr})
+		}
+	}
+
+	sort.SliceStable(headerRules, func(a, b int) bool {
+		return headerRules[a].MoreSpecific(headerRules[b].HostRule)
+	})
+	return nil
+}
+
+// ApplyHeaderRules 将下载地址匹配到的所有请求头规则合并到 headers 中
+//
+// 与定制化配置只有最精确的规则生效不同, 所有匹配的规则都会生效, 同名的请求头以更精确的规则为准
+func ApplyHeaderRules(headers map[string]string, link string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return
+	}
+	// 从优先级最低的规则开始合并, 更精确的规则覆盖之前的值
+	for i := len(headerRules) - 1; i >= 0; i-- {
+		r := headerRules[i]
+		if !r.Match(u) {
+			continue
+		}
+		for k, v := range r.rule.Headers {
+			SetHeader(headers, k, v)
+		}
+	}
+}
+
+// SeedCookieJar 将下载地址匹配到的请求头规则中 cookie 文件的内容写入任务的 cookie jar
+//
+// 写入后由 jar 按照域名、路径以及过期时间决定每个请求携带哪些 cookie
+func SeedCookieJar(jar http.CookieJar, links ...string) {
+	seeded := make(map[*HeaderRule]bool)
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		for _, r := range headerRules {
+			if seeded[r.rule] || len(r.rule.cookies) == 0 || !r.Match(u) {
+				continue
+			}
+			seeded[r.rule] = true
+			for _, c := range r.rule.cookies {
+				cu, hc := c.httpCookie()
+				jar.SetCookies(cu, []*http.Cookie{hc})
+			}
+		}
+	}
+}
+
+// SetHeader 设置请求头, 同时删除名称大小写不同的同名请求头
+func SetHeader(headers map[string]string, key, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+	headers[key] = value
+}
+
+// readCookieFile 读取 Netscape 格式的 cookie 文件, 即 yt-dlp 和浏览器插件导出的 cookies.txt
+func readCookieFile(path string) ([]fileCookie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "打开 cookie 文件失败")
+	}
+	defer file.Close()
+
+	var cookies []fileCookie
+	invalid := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// 以 #HttpOnly_ 开头的是 HttpOnly cookie, 其他以 # 开头的是注释
+		line, httpOnly := strings.CutPrefix(line, "#HttpOnly_")
+		if line == "" || (!httpOnly && strings.HasPrefix(line, "#")) {
+			continue
+		}
+		arr := strings.Split(line, "\t")
+		if len(arr) != 7 {
+			invalid++
+			continue
+		}
+		c := fileCookie{
+			domain:     strings.ToLower(strings.TrimPrefix(arr[0], ".")),
+			subdomains: strings.EqualFold(arr[1], "TRUE") || strings.HasPrefix(arr[0], "."),
+			path:       arr[2],
+			secure:     strings.EqualFold(arr[3], "TRUE"),
+			name:       arr[5],
+			value:      arr[6],
+		}
+		if sec, err := strconv.ParseInt(arr[4], 10, 64); err == nil && sec > 0 {
+			c.expireAt = time.Unix(sec, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "读取 cookie 文件失败")
+	}
+	if invalid > 0 {
+		mylog.Warnf("cookie 文件中有 %d 行格式不正确，已忽略：%s", invalid, path)
+	}
+	return cookies, nil
+}
+
+// httpCookie 转换为写入 cookie jar 的 cookie 以及对应的地址
+func (c fileCookie) httpCookie() (*url.URL, *http.Cookie) {
+	u := &url.URL{Scheme: "https", Host: c.domain, Path: c.path}
+	hc := &http.Cookie{Name: c.name, Value: c.value, Path: c.path, Secure: c.secure, Expires: c.expireAt}
+	if c.subdomains {
+		hc.Domain = c.domain
+	}
+	return u, hc
+}
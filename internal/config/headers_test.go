@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"video-downloader-go/internal/config"
+)
+
+func TestHeaderRules(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cookies := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		".example.com\tTRUE\t/\tFALSE\t0\tsid\tabc",
+		"#HttpOnly_cdn.example.com\tFALSE\t/v/\tTRUE\t4102444800\ttoken\txyz",
+		"old.example.com\tFALSE\t/\tFALSE\t1000000000\texpired\t1",
+		"invalid line",
+	}, "\n")
+	if err := os.WriteFile(cookieFile, []byte(cookies), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loadYaml(t, `
+header-rules:
+  - hosts:
+      - .example.com
+    headers:
+      user-agent: ua
+      Referer: https://example.com
+    cookie-file: `+cookieFile+`
+  - hosts:
+      - cdn.example.com
+    headers:
+      Referer: https://cdn.example.com
+`)
+
+	// 所有匹配的规则都生效, 同名请求头以更精确的规则为准, 并覆盖解析器提供的请求头
+	h := map[string]string{"referer": "decoder", "Cookie": "lang=zh"}
+	config.ApplyHeaderRules(h, "https://cdn.example.com/v/1.ts")
+	if h["Referer"] != "https://cdn.example.com" || h["User-Agent"] != "ua" || h["referer"] != "" || h["Cookie"] != "lang=zh" {
+		t.Fatalf("请求头异常: %v", h)
+	}
+
+	h = map[string]string{}
+	config.ApplyHeaderRules(h, "https://other.com/v.mp4")
+	if len(h) != 0 {
+		t.Fatalf("没有匹配的规则时不应该添加请求头: %v", h)
+	}
+
+	// cookie 文件写入 jar 后按照域名、路径、secure 以及过期时间筛选
+	jar, _ := cookiejar.New(nil)
+	config.SeedCookieJar(jar, "https://other.com/v.mp4")
+	if got := cookieNames(jar, "https://www.example.com/"); got != "" {
+		t.Fatalf("没有匹配的规则时不应该写入 cookie: %v", got)
+	}
+	config.SeedCookieJar(jar, "https://cdn.example.com/v/index.m3u8")
+	cases := []struct{ url, want string }{
+		{"https://cdn.example.com/v/1.ts", "sid,token"},
+		{"http://cdn.example.com/v/1.ts", "sid"},
+		{"https://cdn.example.com/a/1.ts", "sid"},
+		{"https://old.example.com/", "sid"},
+	}
+	for _, c := range cases {
+		if got := cookieNames(jar, c.url); got != c.want {
+			t.Errorf("%s 携带的 cookie 异常: %v", c.url, got)
+		}
+	}
+}
+
+// cookieNames 返回请求 rawUrl 时携带的 cookie 名称, 按照字母顺序排列
+func cookieNames(jar http.CookieJar, rawUrl string) string {
+	u, _ := url.Parse(rawUrl)
+	var names []string
+	for _, c := range jar.Cookies(u) {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
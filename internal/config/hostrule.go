@@ -0,0 +1,124 @@
+// 定制化配置的域名匹配规则
+
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HostRuleKind 域名匹配规则的类型, 数值越大越精确
+type HostRuleKind int
+
+const (
+	HostRuleRegex    HostRuleKind = iota // 正则表达式, 以 re: 开头, 匹配完整的源视频地址
+	HostRuleSuffix                       // 域名后缀, 以 . 开头, 匹配域名本身及其所有子域名
+	HostRuleWildcard                     // 通配符, * 匹配任意个字符
+	HostRuleExact                        // 完整的域名
+)
+
+// HostRuleRegexPrefix 正则表达式规则的前缀
+const HostRuleRegexPrefix = "re:"
+
+// String 返回规则类型的名称
+func (k HostRuleKind) String() string {
+	switch k {
+	case HostRuleRegex:
+		return "regex"
+	case HostRuleSuffix:
+		return "suffix"
+	case HostRuleWildcard:
+		return "wildcard"
+	default:
+		return "exact"
+	}
+}
+
+// HostRule 定制化配置 hosts 中的一条匹配规则
+//
+// 除了正则表达式以外, 规则可以在域名之后加上路径前缀, 如 www.bilibili.com/bangumi/,
+// 域名中带有端口时匹配完整的 host, 否则忽略源视频地址中的端口
+type HostRule struct {
+	Pattern string         // 配置中的原始规则
+	Kind    HostRuleKind   // 规则类型
+	host    string         // 域名部分, 已转换为小写, 后缀规则不包含开头的 .
+	path    string         // 路径前缀, 为空时匹配所有路径
+	re      *regexp.Regexp // 正则表达式规则或通配符规则编译后的结果
+}
+
+// ParseHostRule 解析一条域名匹配规则
+func ParseHostRule(pattern string) (*HostRule, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return nil, errors.New("匹配规则不能为空")
+	}
+	r := &HostRule{Pattern: pattern}
+
+	if expr, ok := strings.CutPrefix(pattern, HostRuleRegexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "正则表达式规则错误：%s", pattern)
+		}
+		r.Kind, r.re = HostRuleRegex, re
+		return r, nil
+	}
+
+	host, path, hasPath := strings.Cut(pattern, "/")
+	if hasPath {
+		r.path = "/" + path
+	}
+	r.host = strings.ToLower(host)
+	switch {
+	case r.host == "":
+		return nil, errors.Errorf("匹配规则缺少域名：%s", pattern)
+	case strings.Contains(r.host, "*"):
+		r.Kind = HostRuleWildcard
+		expr := strings.ReplaceAll(regexp.QuoteMeta(r.host), `\*`, ".*")
+		r.re = regexp.MustCompile("^" + expr + "$")
+	case strings.HasPrefix(r.host, "."):
+		r.Kind, r.host = HostRuleSuffix, strings.TrimPrefix(r.host, ".")
+	default:
+		r.Kind = HostRuleExact
+	}
+	return r, nil
+}
+
+// Match 判断源视频地址是否匹配规则
+func (r *HostRule) Match(u *url.URL) bool {
+	if r.Kind == HostRuleRegex {
+		return r.re.MatchString(u.String())
+	}
+	if r.path != "" && !strings.HasPrefix(u.EscapedPath(), r.path) {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(r.host, ":") {
+		host = strings.ToLower(u.Host)
+	}
+	switch r.Kind {
+	case HostRuleWildcard:
+		return r.re.MatchString(host)
+	case HostRuleSuffix:
+		return host == r.host || strings.HasSuffix(host, "."+r.host)
+	default:
+		return host == r.host
+	}
+}
+
+// MoreSpecific 判断规则是否比 o 更精确
+//
+// 依次比较域名中除通配符以外的字符数、路径前缀的长度、规则类型 (完整域名 > 通配符 > 域名后缀 > 正则表达式),
+// 因此 * 或 *.com 这样宽泛的通配符不会比 .bilibili.com 更精确; 全部相同时返回 false, 由调用方按照配置的顺序决定
+func (r *HostRule) MoreSpecific(o *HostRule) bool {
+	if a, b := len(strings.ReplaceAll(r.host, "*", "")), len(strings.ReplaceAll(o.host, "*", "")); a != b {
+		return a > b
+	}
+	if len(r.path) != len(o.path) {
+		return len(r.path) > len(o.path)
+	}
+	return r.Kind > o.Kind
+}
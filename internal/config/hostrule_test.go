@@ -0,0 +1,152 @@
+package config_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"video-downloader-go/internal/config"
+)
+
+func TestHostRuleMatch(t *testing.T) {
+	cases := []struct {
+		pattern, url string
+		want         bool
+	}{
+		{"www.youtube.com", "https://WWW.youtube.com/watch?v=1", true},
+		{"www.youtube.com", "https://m.youtube.com/watch?v=1", false},
+		{"localhost:8080", "http://localhost:8080/a.mp4", true},
+		{"localhost:8080", "http://localhost:9090/a.mp4", false},
+		{"*.titan.mgtv.com", "https://pcvideotx.titan.mgtv.com/a.m3u8", true},
+		{"*.titan.mgtv.com", "https://titan.mgtv.com/a.m3u8", false},
+		{".mgtv.com", "https://mgtv.com/", true},
+		{".mgtv.com", "https://a.b.mgtv.com/", true},
+		{".mgtv.com", "https://notmgtv.com/", false},
+		{"www.bilibili.com/bangumi/", "https://www.bilibili.com/bangumi/play/ep1", true},
+		{"www.bilibili.com/bangumi/", "https://www.bilibili.com/video/BV1", false},
+		{`re:^https://[^/]+\.bilivideo\.(com|cn)/`, "https://upos-sz.bilivideo.cn/a.m4s", true},
+		{`re:^https://[^/]+\.bilivideo\.(com|cn)/`, "http://upos-sz.bilivideo.cn/a.m4s", false},
+	}
+	for _, c := range cases {
+		r, err := config.ParseHostRule(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(c.url)
+		if got := r.Match(u); got != c.want {
+			t.Errorf("%s 匹配 %s 的结果异常: %v", c.pattern, c.url, got)
+		}
+	}
+
+	for _, p := range []string{"", "re:(", "/path"} {
+		if _, err := config.ParseHostRule(p); err == nil {
+			t.Errorf("非法的规则 %q 应该返回错误", p)
+		}
+	}
+}
+
+func TestHostRuleMoreSpecific(t *testing.T) {
+	cases := []struct {
+		more, less string
+	}{
+		{".x.com", "*"},
+		{".a.b.com/path", "*.com"},
+		{".bilibili.com/bangumi/", "*.com"},
+		{"www.bilibili.com", ".bilibili.com/bangumi/"},
+		{"*.titan.mgtv.com", ".titan.mgtv.com"},
+		{".mgtv.com/b/", ".mgtv.com"},
+		{"*", `re:^https://`},
+	}
+	for _, c := range cases {
+		more, err := config.ParseHostRule(c.more)
+		if err != nil {
+			t.Fatal(err)
+		}
+		less, err := config.ParseHostRule(c.less)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !more.MoreSpecific(less) || less.MoreSpecific(more) {
+			t.Errorf("%s 应该比 %s 更精确", c.more, c.less)
+		}
+	}
+}
+
+// loadYaml 在全局配置的基础上加载 customs 等配置, 不检查运行环境
+func loadYaml(t *testing.T, extra string) {
+	cfg := `
+downloader:
+  download-dir: /tmp
+  dl-thread-count: 8
+transfer:
+  use: ffmpeg_str_v2
+decoder:
+  use: none
+  max-retry: 1
+  youtube-dl:
+    remember-format: 1
+  cat-catch:
+    headless: 1
+` + extra
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 重置全局配置, 避免之前的测试中加载的配置残留
+	*config.G = config.Config{}
+	if err := config.LoadWithoutEnv(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExplainCustoms(t *testing.T) {
+	cfg := `
+customs:
+  - decoder:
+      use: none
+      max-retry: 2
+    hosts:
+      - re:mgtv
+      - .mgtv.com
+  - decoder:
+      use: none
+      max-retry: 3
+    hosts:
+      - "*.mgtv.com"
+      - www.mgtv.com/b/
+  - decoder:
+      use: none
+      max-retry: 4
+    hosts:
+      - "*.titan.mgtv.com"
+      - www.mgtv.com
+`
+	loadYaml(t, cfg)
+
+	cases := []struct {
+		url      string
+		patterns []string
+		maxRetry int
+	}{
+		// 同类规则中域名越长越优先
+		{"https://pcvideotx.titan.mgtv.com/a.m3u8", []string{"*.titan.mgtv.com", "*.mgtv.com", ".mgtv.com", "re:mgtv"}, 4},
+		// 完整域名中路径前缀越长越优先
+		{"https://www.mgtv.com/b/1.html", []string{"www.mgtv.com/b/", "www.mgtv.com", "*.mgtv.com", ".mgtv.com", "re:mgtv"}, 3},
+		{"https://mgtv.com/", []string{".mgtv.com", "re:mgtv"}, 2},
+		{"https://example.com/", nil, 1},
+	}
+	for _, c := range cases {
+		matches := config.ExplainCustoms(c.url)
+		if len(matches) != len(c.patterns) {
+			t.Fatalf("%s 匹配到的规则数量异常: %+v", c.url, matches)
+		}
+		for i, m := range matches {
+			if m.Pattern != c.patterns[i] {
+				t.Fatalf("%s 匹配到的规则顺序异常: %+v", c.url, matches)
+			}
+		}
+		if got := config.G.Decoder.CustomMaxRetry(c.url); got != c.maxRetry {
+			t.Fatalf("%s 生效的定制化配置异常, max-retry: %d", c.url, got)
+		}
+	}
+}
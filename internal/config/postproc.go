@@ -0,0 +1,85 @@
+// 后处理器配置
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PostProcessNone      = "none"      // 不执行任何后处理, 用于在定制化配置中关闭全局的后处理
+	PostProcessFaststart = "faststart" // 将 mp4 的 moov 移动到文件头部, 便于边下边播
+	PostProcessMove      = "move"      // 按照模板移动或重命名文件
+	PostProcessMetadata  = "metadata"  // 写入元数据
+	PostProcessExec      = "exec"      // 执行外部命令
+)
+
+// PostProcessor 单个后处理步骤的配置
+//
+// target, metadata, command 中都可以使用 {name}, {path} 等任务变量
+type PostProcessor struct {
+	Use      string            `yaml:"use"`      // 后处理类型, 可选值：none, faststart, move, metadata, exec
+	Target   string            `yaml:"target"`   // move: 目标路径模板, 相对路径基于文件当前所在目录
+	Metadata map[string]string `yaml:"metadata"` // metadata: 要写入的元数据
+	Command  []string          `yaml:"command"`  // exec: 要执行的命令及参数
+}
+
+// checkFields 检查单个后处理步骤的配置是否合法
+func (pp *PostProcessor) checkFields() error {
+	validTypes := []string{PostProcessNone, PostProcessFaststart, PostProcessMove, PostProcessMetadata, PostProcessExec}
+	pp.Use = strings.TrimSpace(pp.Use)
+
+	switch pp.Use {
+	case PostProcessNone, PostProcessFaststart:
+	case PostProcessMove:
+		if pp.Target = strings.TrimSpace(pp.Target); pp.Target == "" {
+			return errors.New("move 后处理器需要配置 target")
+		}
+	case PostProcessMetadata:
+		if len(pp.Metadata) == 0 {
+			return errors.New("metadata 后处理器需要配置 metadata")
+		}
+	case PostProcessExec:
+		if len(pp.Command) == 0 || strings.TrimSpace(pp.Command[0]) == "" {
+			return errors.New("exec 后处理器需要配置 command")
+		}
+	default:
+		return errors.New("后处理器类型配置错误，可选值：" + strings.Join(validTypes, ","))
+	}
+	return nil
+}
+
+// checkPostProcessors 检查后处理器列表
+func checkPostProcessors(pps []PostProcessor) error {
+	for i := range pps {
+		if err := pps[i].checkFields(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("index: %v", i))
+		}
+	}
+	return nil
+}
+
+// checkPostProcessConfig 检查全局后处理器配置
+func checkPostProcessConfig() error {
+	return checkPostProcessors(G.PostProcessors)
+}
+
+// CustomPostProcessors 返回要对任务执行的后处理器列表
+// 优先返回定制化配置, 列表中出现 none 时表示不执行后处理
+func CustomPostProcessors(originUrl string) []PostProcessor {
+	pps := G.PostProcessors
+	if target := resolvePostProcessorsByUrl(originUrl); len(target) > 0 {
+		pps = target
+	}
+
+	ans := []PostProcessor{}
+	for _, pp := range pps {
+		if pp.Use == PostProcessNone {
+			return []PostProcessor{}
+		}
+		ans = append(ans, pp)
+	}
+	return ans
+}
@@ -0,0 +1,131 @@
+// 代理配置
+
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"video-downloader-go/internal/util/https"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ProxyDirect   = "direct" // 定制化配置中使用, 表示不使用全局配置的代理
+	ProxyNoneRule = "*"      // no-proxy 中使用, 表示所有地址都不使用代理
+)
+
+// Proxy 代理配置
+type Proxy struct {
+	Url      string   `yaml:"url"`      // 代理地址, 支持 http, https, socks5, 如 socks5://127.0.0.1:1080, 可以在地址中携带用户名和密码
+	Username string   `yaml:"username"` // 代理认证的用户名, 不为空时覆盖代理地址中的用户名和密码
+	Password string   `yaml:"password"` // 代理认证的密码
+	NoProxy  []string `yaml:"no-proxy"` // 不使用代理的地址, 写法与定制化配置的 hosts 相同, 另外支持 IP 段, 如 10.0.0.0/8
+
+	url     *url.URL     // 解析后的代理地址, 为空时不使用代理
+	direct  bool         // 定制化配置中显式关闭了代理
+	noAll   bool         // 所有地址都不使用代理
+	noHosts []*HostRule  // 不使用代理的域名规则
+	noNets  []*net.IPNet // 不使用代理的 IP 段
+}
+
+// checkFields 检查代理配置是否合法, 并解析代理地址和 no-proxy 列表
+func (p *Proxy) checkFields(custom bool) error {
+	p.url, p.direct, p.noAll, p.noHosts, p.noNets = nil, false, false, nil, nil
+
+	// 1 解析代理地址
+	p.Url = strings.TrimSpace(p.Url)
+	switch {
+	case p.Url == "":
+	case p.Url == ProxyDirect && custom:
+		p.direct = true
+	default:
+		u, err := url.Parse(p.Url)
+		if err != nil {
+			return errors.Wrapf(err, "代理地址格式错误：%s", p.Url)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return errors.Errorf("代理地址的协议错误, 可选值：http, https, socks5：%s", p.Url)
+		}
+		if u.Hostname() == "" {
+			return errors.Errorf("代理地址缺少主机名：%s", p.Url)
+		}
+		if p.Username = strings.TrimSpace(p.Username); p.Username != "" {
+			u.User = url.UserPassword(p.Username, p.Password)
+		}
+		p.url = u
+	}
+
+	// 2 解析 no-proxy 列表
+	for _, rule := range p.NoProxy {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		if rule == ProxyNoneRule {
+			p.noAll = true
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(rule); err == nil {
+			p.noNets = append(p.noNets, ipNet)
+			continue
+		}
+		hr, err := ParseHostRule(rule)
+		if err != nil {
+			return errors.Wrap(err, "请检查 no-proxy 配置")
+		}
+		p.noHosts = append(p.noHosts, hr)
+	}
+	return nil
+}
+
+// checkProxyConfig 检查全局代理配置, 并设置依赖下载时使用的代理
+func checkProxyConfig() error {
+	if err := G.Proxy.checkFields(false); err != nil {
+		return err
+	}
+	https.SetProxy(G.Proxy.Func())
+	return nil
+}
+
+// Enabled 判断是否配置了代理, 定制化配置中显式关闭代理时同样返回 true
+func (p *Proxy) Enabled() bool {
+	return p.url != nil || p.direct
+}
+
+// URL 返回请求 target 时使用的代理地址, 不使用代理时返回 nil
+func (p *Proxy) URL(target *url.URL) *url.URL {
+	if p.url == nil || p.noAll || target == nil {
+		return nil
+	}
+	if ip := net.ParseIP(target.Hostname()); ip != nil {
+		for _, n := range p.noNets {
+			if n.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	for _, hr := range p.noHosts {
+		if hr.Match(target) {
+			return nil
+		}
+	}
+	return p.url
+}
+
+// RawURL 返回请求 rawUrl 时使用的代理地址, 不使用代理时返回 nil
+func (p *Proxy) RawURL(rawUrl string) *url.URL {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+	return p.URL(u)
+}
+
+// Func 返回可以设置到 http.Transport 中的代理函数
+func (p *Proxy) Func() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		return p.URL(req.URL), nil
+	}
+}
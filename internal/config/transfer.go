@@ -2,14 +2,16 @@
 package config
 
 import (
+	"slices"
 	"strings"
+	"video-downloader-go/internal/util/mylog"
 
 	"github.com/pkg/errors"
 )
 
 type Transfer struct {
-	Use             string `yaml:"use"`               // 要选用哪个转换器，可选值：ffmpeg
-	TsFilenameRegex string `yaml:"ts-filename-regex"` // 正则表达式，用于匹配出 ts 文件的序号
+	Use       string `yaml:"use"`       // 要选用哪个转换器，可选值：ffmpeg
+	Container string `yaml:"container"` // 输出的视频容器，可选值：mp4, mkv, ts, m4a
 }
 
 const (
@@ -18,8 +20,12 @@ const (
 	TransferFfmpegTxt   = "ffmpeg_txt"    // ffmpeg 转换器
 )
 
-// 默认的 ts 文件名序号匹配正则
-const DefaultFilenameRegex = "_(\\d+)\\."
+const (
+	ContainerMP4 = "mp4" // mp4 容器
+	ContainerMKV = "mkv" // mkv 容器, 可以容纳几乎所有编码
+	ContainerTS  = "ts"  // ts 容器
+	ContainerM4A = "m4a" // m4a 容器, 只能容纳音频
+)
 
 // checkFields 检查转换器字段是否合法
 func (t *Transfer) checkFields(allowEmpty bool) error {
@@ -42,10 +48,14 @@ func (t *Transfer) checkFields(allowEmpty bool) error {
 			return errors.New("转换器类型配置错误，可选值：" + strings.Join(validTypes, ","))
 		}
 	}
-
-	t.TsFilenameRegex = strings.TrimSpace(t.TsFilenameRegex)
-	if t.TsFilenameRegex == "" {
-		t.TsFilenameRegex = DefaultFilenameRegex
+	validContainers := []string{ContainerMP4, ContainerMKV, ContainerTS, ContainerM4A}
+	t.Container = strings.ToLower(strings.TrimSpace(t.Container))
+	if t.Container == "" && !allowEmpty {
+		mylog.Warn("没有配置输出容器，使用默认值：mp4")
+		t.Container = ContainerMP4
+	}
+	if t.Container != "" && !slices.Contains(validContainers, t.Container) {
+		return errors.New("输出容器配置错误，可选值：" + strings.Join(validContainers, ","))
 	}
 	return nil
 }
@@ -56,6 +66,5 @@ func checkTransferConfig() error {
 	if err := cfg.checkFields(false); err != nil {
 		return err
 	}
-	increaseSystemUlimit(65535)
 	return nil
 }
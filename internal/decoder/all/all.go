@@ -0,0 +1,12 @@
+// 注册所有内置的解析器
+//
+// 配置校验和任务分发都依赖解析器注册表, 加载配置或者解析任务之前需要空白导入这个包,
+// 新增内置解析器时只需要在这里添加导入
+package all
+
+import (
+	_ "video-downloader-go/internal/decoder/catcatch"
+	_ "video-downloader-go/internal/decoder/execdecoder"
+	_ "video-downloader-go/internal/decoder/pagescan"
+	_ "video-downloader-go/internal/decoder/ytdl"
+)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/util/mylog"
@@ -21,8 +22,9 @@ const (
 )
 
 var (
-	catchScriptCache string   // 猫抓脚本缓存
-	cdpScriptsCache  []string // cdp 脚本缓存, 访问页面时会按顺序执行
+	catchScriptCache string     // 猫抓脚本缓存
+	cdpScriptsCache  []string   // cdp 脚本缓存, 访问页面时会按顺序执行
+	scriptCacheMu    sync.Mutex // 多个解析协程会同时加载脚本, 读写缓存时需要加锁
 )
 
 // UserCookie 记录浏览器的 http cookie 信息
@@ -35,6 +37,8 @@ type UserCookie struct {
 
 // loadCatCatchScript 加载猫抓脚本, 有缓存时返回缓存
 func loadCatCatchScript() (string, error) {
+	scriptCacheMu.Lock()
+	defer scriptCacheMu.Unlock()
 	if catchScriptCache != "" {
 		return catchScriptCache, nil
 	}
@@ -48,7 +52,7 @@ func loadCatCatchScript() (string, error) {
 	return catchScriptCache, nil
 }
 
-// loadCdpScript2Cache 加载单个 cdp 脚本到缓存中
+// loadCdpScript2Cache 加载单个 cdp 脚本到缓存中, 调用方需要持有 scriptCacheMu
 func loadCdpScript2Cache(elms ...string) error {
 	elms = append([]string{scriptBasePath}, elms...)
 	bytes, err := os.ReadFile(filepath.Join(elms...))
@@ -61,6 +65,8 @@ func loadCdpScript2Cache(elms ...string) error {
 
 // loadCdpScripts 加载页面预加载脚本, 有缓存时返回缓存
 func loadCdpScripts() ([]string, error) {
+	scriptCacheMu.Lock()
+	defer scriptCacheMu.Unlock()
 	if len(cdpScriptsCache) != 0 {
 		return cdpScriptsCache, nil
 	}
@@ -125,7 +131,8 @@ func (cc *CatCatcher) Run(actions ...chromedp.Action) error {
 }
 
 // NewCatCather 初始化并运行一个猫抓 chromedriver 实例
-func NewCatCather() (*CatCatcher, error) {
+// @param pageUrl 要解析的源视频地址, 用于选择代理
+func NewCatCather(pageUrl string) (*CatCatcher, error) {
 	cc := CatCatcher{
 		cancelFuncs: []context.CancelFunc{},
 	}
@@ -147,6 +154,8 @@ func NewCatCather() (*CatCatcher, error) {
 	if config.G.Decoder.CatCatch.Headless == config.CatCatchHeadlessActive {
 		opts = append(opts, chromedp.Headless)
 	}
+	proxyOpts, proxyUser := proxyOptions(pageUrl)
+	opts = append(opts, proxyOpts...)
 
 	// 生成 context
 	allocator, c := chromedp.NewExecAllocator(context.Background(), opts...)
@@ -157,7 +166,11 @@ func NewCatCather() (*CatCatcher, error) {
 	defer func() { cc.cancelFuncs = append(cc.cancelFuncs, tc) }()
 
 	// 运行一遍, 没报错才能进行后续解析任务
-	if err := chromedp.Run(browserCtx); err != nil {
+	actions := []chromedp.Action{}
+	if proxyUser != nil {
+		actions = append(actions, handleProxyAuth(browserCtx, proxyUser))
+	}
+	if err := chromedp.Run(browserCtx, actions...); err != nil {
 		return nil, err
 	}
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/decoder/catcatch"
 	"video-downloader-go/internal/util/mylog"
 )
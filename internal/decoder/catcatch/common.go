@@ -3,8 +3,12 @@ package catcatch
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
+	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
 
 	"github.com/chromedp/cdproto/cdp"
@@ -60,3 +64,21 @@ func (d *baseDecoder) SetCookiesActionFunc(cookies []*UserCookie, url string) ch
 		return nil
 	})
 }
+
+// newResult 将选中的猫抓资源封装为解析结果
+//
+// 猫抓抓取的通常是 m3u8 资源, 下载地址中包含 .m3u8 时直接作为资源类型提示, 省去下载器的探测请求,
+// 注入浏览器的 cookie 同样交给下载器, 部分 CDN 需要登录态才能下载分片,
+// 页面标题作为文件名模板变量 title, 配置的清晰度 video-format 对应的标签作为文件名模板变量 quality
+func newResult(dlUrl string, cookies []*UserCookie, title, quality string) *meta.DecodeResult {
+	res := meta.NewDecodeResult(dlUrl)
+	res.Title = strings.TrimSpace(title)
+	res.Meta = map[string]string{"quality": quality}
+	for _, c := range cookies {
+		res.Cookies = append(res.Cookies, &http.Cookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path})
+	}
+	if u, err := url.Parse(dlUrl); err == nil && strings.HasSuffix(u.Path, ".m3u8") {
+		res.Resource = meta.ResourceM3U8
+	}
+	return res
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
 
 	"github.com/chromedp/cdproto/cdp"
@@ -24,18 +25,15 @@ var format2PayloadMg = map[string]string{
 
 // MgDecoder 适配芒果 TV 的猫抓解析器, id => cat-catch:mg
 // 实现解析器接口
+//
+// 解析器不保存解析过程中的状态, 可以在多个协程中并发使用
 type MgDecoder struct {
 	baseDecoder
-	// url 记录当前正在解析的 url 地址
-	url string
 }
 
-// 解析并获取下载链接列表
-// 对于 youtube-dl 解析器, 有可能会返回两条链接, 因为部分站点的解析结果是音视频分开的
-// 其他解析器通常只返回一条链接
-func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
+// Decode 解析资源, 返回用户指定清晰度的 m3u8 资源
+func (mg *MgDecoder) Decode(url string) (*meta.DecodeResult, error) {
 	// 解析配置
-	mg.url = url
 	videoFormat := config.G.Decoder.CatCatch.Sites.Mg.VideoFormat
 	if videoFormat == "" {
 		return nil, errors.New("未配置要解析的清晰度")
@@ -46,7 +44,7 @@ func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
 	}
 
 	// 初始化猫抓解析器
-	cc, err := NewCatCather()
+	cc, err := NewCatCather(url)
 	if err != nil {
 		return nil, fmt.Errorf("初始化猫抓解析器失败: %v", err)
 	}
@@ -58,6 +56,7 @@ func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
 
 	var nodes []*cdp.Node
 	var text string
+	var title string
 	var evalRes []string
 	err = cc.Run(
 		// 跳转到待解析的 url 地址
@@ -70,6 +69,7 @@ func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		// 注入 Cookie
 		mg.SetCookiesActionFunc(cookies, url),
 		chromedp.Reload(),
+		chromedp.Title(&title),
 
 		// 通过检查用户头像判断用户是否登录
 		chromedp.Nodes(".top-header-v2-actions__avatar__img", &nodes, chromedp.ByQuery),
@@ -193,7 +193,7 @@ func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
 
 	// 系统自动检查结果中是否有默认的 m3u8 链接地址, 有则无需用户手动选择
 	if dlUrl, ok := mg.ChooseDefaultResult(results); ok {
-		return []string{dlUrl}, nil
+		return newResult(dlUrl, cookies, title, formatPayload), nil
 	}
 
 	// 阻塞系统日志, 调用选择器, 让用户选择要使用抓取到的哪个资源
@@ -202,7 +202,7 @@ func (mg *MgDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		return nil, errors.Wrap(err, "资源选择失败")
 	}
 
-	return []string{dlUrl}, nil
+	return newResult(dlUrl, cookies, title, formatPayload), nil
 }
 
 // ChooseDefaultResult 从猫抓解析结果中自动识别一条可用的 m3u8 地址
@@ -0,0 +1,79 @@
+package catcatch
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/chromedp"
+)
+
+// proxyOptions 返回源视频地址对应的 chrome 代理参数, 以及代理需要的认证信息
+//
+// chrome 不读取 proxy-server 中的用户名和密码, 需要认证时由 handleProxyAuth 响应认证请求
+func proxyOptions(pageUrl string) ([]chromedp.ExecAllocatorOption, *url.Userinfo) {
+	proxy := config.G.Proxy.CustomProxy(pageUrl)
+	if !proxy.Enabled() {
+		return nil, nil
+	}
+	u := proxy.RawURL(pageUrl)
+	if u == nil {
+		return []chromedp.ExecAllocatorOption{chromedp.Flag("no-proxy-server", true)}, nil
+	}
+
+	opts := []chromedp.ExecAllocatorOption{chromedp.ProxyServer(u.Scheme + "://" + u.Host)}
+	// chrome 不支持正则表达式和路径前缀, 只传递域名部分
+	bypass := []string{}
+	for _, rule := range proxy.NoProxy {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || strings.HasPrefix(rule, config.HostRuleRegexPrefix) {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(rule); err == nil {
+			// IP 段, 如 10.0.0.0/8
+			bypass = append(bypass, rule)
+			continue
+		}
+		host, _, _ := strings.Cut(rule, "/")
+		bypass = append(bypass, host)
+	}
+	if len(bypass) > 0 {
+		opts = append(opts, chromedp.Flag("proxy-bypass-list", strings.Join(bypass, ";")))
+	}
+
+	if u.User == nil {
+		return opts, nil
+	}
+	if u.Scheme == "socks5" {
+		mylog.Warn("chrome 不支持需要认证的 socks5 代理，猫抓解析器可能无法访问页面")
+		return opts, nil
+	}
+	return opts, u.User
+}
+
+// handleProxyAuth 开启请求拦截, 使用配置中的用户名和密码响应代理的认证请求
+func handleProxyAuth(ctx context.Context, user *url.Userinfo) chromedp.Action {
+	password, _ := user.Password()
+	chromedp.ListenTarget(ctx, func(ev any) {
+		switch e := ev.(type) {
+		case *fetch.EventRequestPaused:
+			// 开启拦截后所有请求都会暂停, 需要逐个放行
+			go chromedp.Run(ctx, fetch.ContinueRequest(e.RequestID))
+		case *fetch.EventAuthRequired:
+			resp := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseDefault}
+			if e.AuthChallenge != nil && e.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
+				resp = &fetch.AuthChallengeResponse{
+					Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+					Username: user.Username(),
+					Password: password,
+				}
+			}
+			go chromedp.Run(ctx, fetch.ContinueWithAuth(e.RequestID, resp))
+		}
+	})
+	return fetch.Enable().WithHandleAuthRequests(true)
+}
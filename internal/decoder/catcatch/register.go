@@ -0,0 +1,32 @@
+package catcatch
+
+import (
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/decoder"
+
+	"github.com/pkg/errors"
+)
+
+// 解析器类型
+const (
+	NameTx = "cat-catch:tx"
+	NameMg = "cat-catch:mg"
+)
+
+func init() {
+	opts := decoder.Options{
+		Interactive: true,
+		NeedBrowser: true,
+		Check:       checkConfig,
+	}
+	decoder.Register(NameTx, func(string) decoder.D { return new(TxDecoder) }, opts)
+	decoder.Register(NameMg, func(string) decoder.D { return new(MgDecoder) }, opts)
+}
+
+// checkConfig 检查猫抓解析器的配置
+func checkConfig(dc *config.Decoder, allowEmpty bool) error {
+	if !dc.CatCatch.IsHeadlessValid() && !allowEmpty {
+		return errors.New("headless 配置错误, 可选择: -1, 1")
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
 
 	"github.com/chromedp/cdproto/cdp"
@@ -27,14 +28,14 @@ var format2PayloadTx = map[string]string{
 
 // 适配腾讯视频的猫抓解析器, id => cat-catch:tx
 // 实现解析器接口
+//
+// 解析器不保存解析过程中的状态, 可以在多个协程中并发使用
 type TxDecoder struct {
 	baseDecoder
-	url string // 记录当前正在解析的 url 地址
 }
 
 // 解析资源
-func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
-	td.url = url
+func (td *TxDecoder) Decode(url string) (*meta.DecodeResult, error) {
 	videoFormat := config.G.Decoder.CatCatch.Sites.Tx.VideoFormat
 	if videoFormat == "" {
 		return nil, errors.New("未配置要解析的清晰度")
@@ -44,7 +45,7 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		return nil, fmt.Errorf("错误的清晰度配置: %s", videoFormat)
 	}
 
-	cc, err := NewCatCather()
+	cc, err := NewCatCather(url)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +57,7 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 
 	var nodes []*cdp.Node
 	var text string
+	var title string
 	var needWaitAd bool
 	var evalRes []string
 	err = cc.Run(
@@ -69,6 +71,7 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		// 注入 Cookie
 		td.SetCookiesActionFunc(cookies, url),
 		chromedp.Reload(),
+		chromedp.Title(&title),
 		chromedp.WaitVisible(".quick_user_avatar", chromedp.ByQuery),
 		chromedp.Sleep(time.Millisecond*100),
 
@@ -120,7 +123,7 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		}),
 
 		// 注入 JS 脚本, 弹出清晰度选择框
-		td.ShowPlayerCover(),
+		td.ShowPlayerCover(url),
 
 		// 点击用户指定的清晰度按钮
 		chromedp.Click(fmt.Sprintf("[data-value=%s]", videoFormat), chromedp.ByQuery),
@@ -172,7 +175,7 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 
 	// 系统自动检查结果中是否有默认的 m3u8 链接地址, 有则无需用户手动选择
 	if dlUrl, ok := td.ChooseDefaultResult(results); ok {
-		return []string{dlUrl}, nil
+		return newResult(dlUrl, cookies, title, formatPayload), nil
 	}
 
 	// 阻塞系统日志, 调用选择器, 让用户选择要使用抓取到的哪个资源
@@ -181,11 +184,13 @@ func (td *TxDecoder) FetchDownloadLinks(url string) ([]string, error) {
 		return nil, errors.Wrap(err, "资源选择失败")
 	}
 
-	return []string{dlUrl}, nil
+	return newResult(dlUrl, cookies, title, formatPayload), nil
 }
 
 // ShowPlayerCover 往页面中注入辅助脚本, 使得原本被隐藏的播放器信息能够显示
-func (td *TxDecoder) ShowPlayerCover() chromedp.Action {
+//
+// url 是当前正在解析的地址, 仅用于输出日志
+func (td *TxDecoder) ShowPlayerCover(url string) chromedp.Action {
 	return chromedp.ActionFunc(func(ctx context.Context) error {
 		mylog.Info("正在注入辅助 JS 脚本...")
 		_, errDts, err := runtime.Evaluate(`
@@ -195,7 +200,7 @@ func (td *TxDecoder) ShowPlayerCover() chromedp.Action {
 			}
 		`).Do(ctx)
 		if errDts != nil || err != nil {
-			mylog.Warnf("注入 JS 脚本失败, 可能导致无法解析到指定清晰度资源, url: %s, errDts: %v, err: %v", td.url, errDts, err)
+			mylog.Warnf("注入 JS 脚本失败, 可能导致无法解析到指定清晰度资源, url: %s, errDts: %v, err: %v", url, errDts, err)
 		}
 		return nil
 	})
@@ -1,135 +1,259 @@
 package decoder
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
 	"time"
+	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/config"
-	"video-downloader-go/internal/downloader"
+	"video-downloader-go/internal/jobstore"
 	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
+	"video-downloader-go/internal/util/mysemaphore"
 )
 
 // 解析器通用接口
 type D interface {
-	// 解析并获取下载链接列表
-	// 对于 youtube-dl 解析器, 有可能会返回两条链接, 因为部分站点的解析结果是音视频分开的
-	// 其他解析器通常只返回一条链接
-	FetchDownloadLinks(url string) ([]string, error)
+	// 解析源视频地址, 返回媒体流及其请求头、资源类型、元数据和过期时间
+	// 对于 youtube-dl 解析器, 有可能会返回音视频分开的两个媒体流
+	// 其他解析器通常只返回一个完整资源
+	Decode(url string) (*meta.DecodeResult, error)
 }
 
 // 解析成功的处理函数
 type DecodeSuccessHandler func(*meta.Download)
 
-// 解析完成后将下载数据构建成 DownloadMeta
-type DownloadMetaBuilder func([]string, *meta.Video) *meta.Download
-
-func ListenAndDecode(list *meta.TaskDeque[meta.Video], decodeSuccess DecodeSuccessHandler) {
-	mylog.Info("开始监听解析列表")
-	go func() {
-		ticker := NewGrowableTicker(30, 5*60, 0.17)
-	out:
-		for {
-			// 没有任务处理时, 每阻塞 2 秒检查一次任务列表
-			for list.Empty() {
-				time.Sleep(time.Second * 2)
-			}
+// 解析失败的处理函数, 任务已经用完了解析的尝试次数, 不会再被处理
+type DecodeFailHandler func(*meta.Video, error)
 
-			// 获取链接地址
-			vmt := list.PollFirst()
-			mylog.Infof("识别到解析任务, 标题：%s, 源地址：%s", vmt.Name, vmt.Url)
-			vmt.LogBar.DecodeHint("解析中...")
-
-			// 判断解析类型
-			use := config.G.Decoder.CustomUse(vmt.Url)
-			maxRetry := config.G.Decoder.CustomMaxRetry(vmt.Url)
-			currentTry := 1
-			dcd := GetDecoder(use)
-			var dmt *meta.Download
-			var decodeErr error
-
-			for currentTry <= maxRetry {
-				switch use {
-				case config.DecoderNone:
-					dmt, decodeErr = meta.NewDownloadMeta(vmt.Url, vmt.Name, vmt.Url), nil
-				case config.DecoderYoutubeDl:
-					dmt, decodeErr = useYoutubeDlDecode(dcd, vmt)
-				case config.DecoderCatCatchTx:
-					dmt, decodeErr = useCatCatchTxDecode(dcd, vmt)
-				case config.DecoderCatCatchMg:
-					dmt, decodeErr = useCatCatchMgDecode(dcd, vmt)
-				default:
-					decodeErr = errors.New("不支持的解析器类型")
+// ListenAndDecode 监听解析列表并解析任务
+//
+// 启动 config.G.Decoder.Workers 个解析协程, 每种解析器同时解析的任务数不超过 UseWorkersOf 的限制,
+// 某种解析器达到上限时, 解析协程会跳过该类型的任务, 优先解析其他类型的任务;
+// slots 限制了已解析但还没有处理结束的任务数, 每解析一个任务之前都需要先占用一个位置,
+// 位置由调用方在任务处理结束时释放, 这样解析器只会在下载器即将空闲时解析, 避免下载地址过期
+func ListenAndDecode(list *meta.TaskDeque[meta.Video], slots *mysemaphore.Semaphore, decodeSuccess DecodeSuccessHandler, decodeFail DecodeFailHandler) {
+	workers := config.G.Decoder.Workers
+	mylog.Infof("开始监听解析列表, 解析并发数：%d", workers)
+	limiter := &useLimiter{list: list, sems: make(map[string]*mysemaphore.Semaphore)}
+	for i := 0; i < max(workers, 1); i++ {
+		go func() {
+			ctx := appctx.Context()
+			for {
+				// 等待下载器空出位置, 再阻塞等待可以解析的任务, 程序终止或队列关闭时退出
+				if err := slots.Acquire(ctx); err != nil {
+					return
 				}
-
-				if decodeErr == nil {
-					vmt.LogBar.WaitingHint("解析完成, 等待下载")
-					dmt.LogBar = vmt.LogBar
-					decodeSuccess(dmt)
-
-					// 通常情况下, 解析任务处理速率远高于下载任务
-					// 所以这里阻塞一段较长的时间, 避免解析过快
-					if len(downloader.CanDownloadChan) != 0 {
-						<-downloader.CanDownloadChan
-					}
-					select {
-					case <-sleep2Channel(time.Second * ticker.Next()):
-					case <-downloader.CanDownloadChan:
-					}
-
-					continue out
+				var chain []config.DecoderStep
+				vmt, err := list.TakeMatch(ctx, func(v *meta.Video) bool {
+					chain = chainOf(v.Url)
+					return limiter.tryAcquire(chain[0].Use)
+				})
+				if err != nil {
+					slots.Release()
+					return
 				}
+				decodeOne(vmt, chain, limiter, decodeSuccess, decodeFail)
+			}
+		}()
+	}
+}
+
+// winners 记录每个 host 最近一次解析成功的解析器类型, 程序运行期间有效
+var winners sync.Map
+
+// hostOf 返回源视频地址的 host, 解析失败时返回原地址
+func hostOf(rawUrl string) string {
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawUrl
+}
+
+// chainOf 返回任务按照顺序尝试的解析器链
+//
+// 同一个 host 之前有任务解析成功时, 成功的解析器排在最前面, 其他解析器保持配置的顺序
+func chainOf(rawUrl string) []config.DecoderStep {
+	chain := config.G.Decoder.CustomChain(rawUrl)
+	winner, ok := winners.Load(hostOf(rawUrl))
+	if !ok {
+		return chain
+	}
+	i := slices.IndexFunc(chain, func(s config.DecoderStep) bool { return s.Use == winner })
+	if i > 0 {
+		step := chain[i]
+		chain = slices.Insert(slices.Delete(chain, i, i+1), 0, step)
+	}
+	return chain
+}
 
-				mylog.Warnf("尝试解析失败 (%d/%d): %v", currentTry, maxRetry, decodeErr)
-				time.Sleep(time.Second)
-				currentTry++
+// decodeOne 按照解析器链的顺序解析一个任务, 每个解析器失败时按照各自配置的次数重试
+//
+// 调用前需要占用解析器链中第一个解析器的位置, 切换到下一个解析器时先释放当前的位置再等待下一个位置,
+// 避免多个协程互相持有对方需要的位置
+func decodeOne(vmt *meta.Video, chain []config.DecoderStep, limiter *useLimiter, decodeSuccess DecodeSuccessHandler, decodeFail DecodeFailHandler) {
+	mylog.Infof("识别到解析任务, 标题：%s, 源地址：%s", vmt.Name, vmt.Url)
+	vmt.LogBar.DecodeHint("解析中...")
+	jobstore.G.SetState(vmt.Id, meta.TaskDecoding)
+
+	var decodeErr error
+	for i, step := range chain {
+		if i > 0 {
+			limiter.release(chain[i-1].Use)
+			mylog.Warnf("解析器 %s 解析失败, 尝试使用备用解析器 %s, 标题：%s", chain[i-1].Use, step.Use, vmt.Name)
+			vmt.LogBar.DecodeHint("解析中 (" + step.Use + ")...")
+			if err := limiter.acquire(appctx.Context(), step.Use); err != nil {
+				// 程序终止
+				return
 			}
-			vmt.LogBar.ErrorHint("解析失败")
-			mylog.Errorf("视频下载地址解析失败: %v", decodeErr)
 		}
-	}()
-}
 
-// useCatCatchMgDecode 调用 cat-catch:mg 解析器来解析下载地址
-func useCatCatchMgDecode(dcd D, vmt *meta.Video) (*meta.Download, error) {
-	return decode2Dmt(dcd, vmt, func(s []string, v *meta.Video) *meta.Download {
-		return meta.NewDownloadMeta(s[0], v.Name, v.Url)
+		dmt, err := decodeWith(vmt, step)
+		if err != nil {
+			decodeErr = err
+			continue
+		}
+		limiter.release(step.Use)
+		winners.Store(hostOf(vmt.Url), step.Use)
+
+		vmt.LogBar.WaitingHint("解析完成 (" + step.Use + "), 等待下载")
+		dmt.Id, dmt.LogBar = vmt.Id, vmt.LogBar
+		dmt.Tries, dmt.Priority = vmt.Tries, vmt.Priority
+		dmt.SetHeaders(vmt.Headers)
+		if step.Use != config.DecoderNone && dmt.ExpireAt.IsZero() {
+			// 解析器没有提供过期时间时, 根据下载地址推测
+			dmt.ExpireAt = meta.LinkExpireAt(meta.StreamLinks(dmt.Streams)...)
+		}
+		jobstore.G.Update(vmt.Id, func(t *meta.Task) {
+			t.State, t.Error = meta.TaskDecoded, ""
+			t.SetDownload(dmt)
+		})
+		decodeSuccess(dmt)
+		return
+	}
+	limiter.release(chain[len(chain)-1].Use)
+
+	vmt.LogBar.ErrorHint("解析失败")
+	jobstore.G.Update(vmt.Id, func(t *meta.Task) {
+		t.State, t.Error = meta.TaskFailed, decodeErr.Error()
 	})
+	mylog.Errorf("视频下载地址解析失败, 标题：%s: %v", vmt.Name, decodeErr)
+	decodeFail(vmt, decodeErr)
 }
 
-// useCatCatchTxDecode 调用 cat-catch:tx 解析器来解析下载地址
-func useCatCatchTxDecode(dcd D, vmt *meta.Video) (*meta.Download, error) {
-	return decode2Dmt(dcd, vmt, func(s []string, v *meta.Video) *meta.Download {
-		return meta.NewDownloadMeta(s[0], v.Name, v.Url)
-	})
+// decodeWith 使用解析器链中的一个解析器解析任务, 失败时按照配置的次数重试
+func decodeWith(vmt *meta.Video, step config.DecoderStep) (*meta.Download, error) {
+	dcd := GetDecoder(step.Use)
+	var dmt *meta.Download
+	var decodeErr error
+
+	for currentTry := 1; currentTry <= step.MaxRetry; currentTry++ {
+		switch {
+		case step.Use == config.DecoderNone:
+			return meta.NewDownloadMeta(vmt.Url, vmt.Name, vmt.Url), nil
+		case dcd == nil:
+			// 配置校验时已经检查过解析器类型, 重试也不会成功
+			return nil, errors.New("不支持的解析器类型：" + step.Use)
+		default:
+			dmt, decodeErr = decode2Dmt(dcd, step.Use, vmt)
+		}
+		if decodeErr == nil {
+			return dmt, nil
+		}
+
+		mylog.Warnf("尝试解析失败 (%s %d/%d), 标题：%s: %v", step.Use, currentTry, step.MaxRetry, vmt.Name, decodeErr)
+		if currentTry == step.MaxRetry {
+			break
+		}
+		// 等待一段时间后重试, 程序终止时不再等待
+		select {
+		case <-appctx.Context().Done():
+			return nil, decodeErr
+		case <-time.After(time.Second):
+		}
+	}
+	return nil, decodeErr
 }
 
-// useYoutubeDlDecode 调用 youtube-dl 解析器来解析下载地址
-func useYoutubeDlDecode(dcd D, vmt *meta.Video) (*meta.Download, error) {
-	return decode2Dmt(dcd, vmt, func(s []string, v *meta.Video) *meta.Download {
-		return meta.NewYtDlDownloadMeta(s, v.Name, v.Url)
-	})
+// useLimiter 限制每种解析器同时解析的任务数
+type useLimiter struct {
+	mu   sync.Mutex
+	list *meta.TaskDeque[meta.Video]       // 释放位置时需要唤醒等待中的解析协程
+	sems map[string]*mysemaphore.Semaphore // 解析器类型 => 信号量, 第一次使用时创建
 }
 
-// decode2Dmt 通用的解析逻辑, 解析完成后, 使用 dmtBuilder 构建成 DownloadMeta 返回
-func decode2Dmt(dcd D, vmt *meta.Video, dmtBuilder DownloadMetaBuilder) (*meta.Download, error) {
+// sem 返回解析器类型对应的信号量
+func (l *useLimiter) sem(use string) *mysemaphore.Semaphore {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.sems[use]
+	if !ok {
+		s = mysemaphore.New(workerLimit(use))
+		l.sems[use] = s
+	}
+	return s
+}
+
+// workerLimit 返回指定解析器类型同时解析的任务上限, 需要浏览器或者需要控制台输入的解析器没有单独配置时默认为 1
+func workerLimit(use string) int {
+	if _, ok := config.G.Decoder.UseWorkers[use]; !ok {
+		if opts, _ := Lookup(use); opts.NeedBrowser || opts.Interactive {
+			return 1
+		}
+	}
+	return config.G.Decoder.UseWorkersOf(use)
+}
+
+// tryAcquire 尝试占用一个解析位置, 该类型的解析器已经达到上限时返回 false
+func (l *useLimiter) tryAcquire(use string) bool {
+	return l.sem(use).TryAcquire()
+}
+
+// acquire 阻塞等待一个解析位置, ctx 结束时返回错误
+func (l *useLimiter) acquire(ctx context.Context, use string) error {
+	return l.sem(use).Acquire(ctx)
+}
+
+// release 释放解析位置, 唤醒因为该类型达到上限而等待的解析协程
+func (l *useLimiter) release(use string) {
+	l.sem(use).Release()
+	l.list.Notify()
+}
+
+// decode2Dmt 通用的解析逻辑, 解析完成后, 按照解析器声明的能力校验解析结果, 并构建成 DownloadMeta 返回
+func decode2Dmt(dcd D, use string, vmt *meta.Video) (*meta.Download, error) {
 	mylog.Infof("开始解析视频, 文件名：%s, 源地址：%s", vmt.Name, vmt.Url)
-	links, err := dcd.FetchDownloadLinks(vmt.Url)
+	res, err := dcd.Decode(vmt.Url)
 	if err != nil {
 		return nil, err
 	}
-	mylog.Successf("解析成功, 已添加到下载列表, 文件名：%s, 下载地址：%s", vmt.Name, links)
-	return dmtBuilder(links, vmt), nil
+	if err = CheckResult(res, use); err != nil {
+		return nil, err
+	}
+	mylog.Successf("解析成功, 已添加到下载列表, 文件名：%s, 下载地址：%s", vmt.Name, res.Links())
+	return res.Download(vmt.Name, vmt.Url), nil
 }
 
-// sleep2Channel 将线程睡眠转换成通道读取形式
-func sleep2Channel(duration time.Duration) <-chan struct{} {
-	ch := make(chan struct{}, 1)
-
-	go func() {
-		time.Sleep(duration)
-		ch <- struct{}{}
-		close(ch)
-	}()
-
-	return ch
+// CheckResult 校验解析结果, 至少包含一个音视频流, 没有声明 MultiStream 的解析器只能返回一个音视频流
+func CheckResult(res *meta.DecodeResult, use string) error {
+	if res == nil {
+		return errors.New("解析结果中没有可以下载的音视频流")
+	}
+	media := 0
+	for _, s := range res.Streams {
+		if s.Media() {
+			media++
+		}
+	}
+	if media == 0 {
+		return errors.New("解析结果中没有可以下载的音视频流")
+	}
+	if opts, _ := Lookup(use); media > 1 && !opts.MultiStream {
+		return fmt.Errorf("解析器 %s 不支持返回多个音视频流, 实际返回了 %d 个", use, media)
+	}
+	return nil
 }
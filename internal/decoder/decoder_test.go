@@ -1,14 +1,53 @@
 package decoder_test
 
 import (
-	"log"
+	"errors"
 	"testing"
+	"time"
+	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/decoder"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mylog/dlbar"
+	"video-downloader-go/internal/util/mysemaphore"
 )
 
-func TestTicker(t *testing.T) {
-	gt := decoder.NewGrowableTicker(10, 5*60, 0.2)
-	for i := 0; i < 1000; i++ {
-		log.Println(gt.Next())
+type failingDecoder struct{}
+
+func (*failingDecoder) Decode(url string) (*meta.DecodeResult, error) {
+	return nil, errors.New("解析失败")
+}
+
+// 测试最后一次尝试失败后不再等待, 直接切换到下一个解析器或者结束任务
+func TestDecodeNoWaitAfterLastTry(t *testing.T) {
+	decoder.Register("failing", func(string) decoder.D { return new(failingDecoder) }, decoder.Options{})
+	decoder.Register("failing-fallback", func(string) decoder.D { return new(failingDecoder) }, decoder.Options{})
+
+	origin := config.G.Decoder
+	defer func() { config.G.Decoder = origin }()
+	config.G.Decoder.Use, config.G.Decoder.MaxRetry, config.G.Decoder.Workers = "failing", 1, 1
+	config.G.Decoder.Fallbacks = []config.DecoderStep{{Use: "failing-fallback", MaxRetry: 1}}
+
+	list := new(meta.TaskDeque[meta.Video])
+	defer list.Close()
+	list.OfferLast(&meta.Video{Name: "测试", Url: "https://example.com/1", LogBar: dlbar.NewBar()})
+
+	done := make(chan error, 1)
+	start := time.Now()
+	decoder.ListenAndDecode(list, mysemaphore.New(1), func(*meta.Download) {
+		done <- nil
+	}, func(_ *meta.Video, err error) {
+		done <- err
+	})
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("所有解析器都失败时任务应失败")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("等待解析结束超时")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("最后一次尝试失败后不应再等待, 耗时: %v", elapsed)
 	}
 }
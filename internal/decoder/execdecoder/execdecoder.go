@@ -0,0 +1,225 @@
+// 外部进程解析器, 通过 JSON 协议调用其他语言编写的解析脚本
+//
+// 解析时启动配置的命令, 向标准输入写入一个 JSON 请求:
+//
+//	{"name": "foo", "url": "源视频地址", "options": {站点配置}}
+//
+// 外部进程需要在标准输出中写入一个 JSON 响应, 以退出码 0 结束:
+//
+//	{
+//	  "links": ["下载地址"],                  // 简单写法, 与 streams 二选一
+//	  "streams": [{"url": "", "role": "video", "headers": {}}],
+//	  "headers": {"Referer": ""},            // 所有媒体流共用的请求头, Cookie 也放在这里
+//	  "resource": "m3u8",                    // 音视频流的资源类型提示, 可选值: mp4, m3u8
+//	  "title": "视频标题",
+//	  "meta": {"quality": "1080P"},          // 文件名模板变量
+//	  "expire_at": 1700000000,               // 下载地址的过期时间, unix 时间戳 (秒)
+//	  "error": "失败原因"                    // 不为空时表示解析失败
+//	}
+//
+// 标准错误中的每一行都会作为日志输出, 退出码不为 0 或者超时时视为解析失败
+package execdecoder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+	"video-downloader-go/internal/appctx"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/decoder"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Prefix 解析器类型前缀, 完整的类型为 exec:名称
+	Prefix = "exec:"
+
+	// DefaultTimeout 没有配置超时时间时, 单次解析的超时时间
+	DefaultTimeout = 2 * time.Minute
+)
+
+func init() {
+	decoder.Register(Prefix+config.DecoderFamilySuffix, func(name string) decoder.D {
+		return &Decoder{name: strings.TrimPrefix(name, Prefix)}
+	}, decoder.Options{
+		MultiStream: true,
+		Check:       checkConfig,
+	})
+}
+
+// Decoder 外部进程解析器, 实现解析器接口
+//
+// 每次解析都会启动一个新的进程, 解析器本身只保存名称, 可以在多个协程中并发使用
+type Decoder struct {
+	name string // 配置中的名称, 不包含 exec: 前缀
+}
+
+// request 写入外部进程标准输入的请求
+type request struct {
+	Name    string         `json:"name"`
+	Url     string         `json:"url"`
+	Options map[string]any `json:"options"`
+}
+
+// stream 外部进程返回的媒体流
+type stream struct {
+	Url     string            `json:"url"`
+	Role    meta.StreamRole   `json:"role"`
+	Headers map[string]string `json:"headers"`
+}
+
+// response 外部进程写入标准输出的响应
+type response struct {
+	Links    []string          `json:"links"`
+	Streams  []stream          `json:"streams"`
+	Headers  map[string]string `json:"headers"`
+	Resource meta.ResourceType `json:"resource"`
+	Title    string            `json:"title"`
+	Meta     map[string]string `json:"meta"`
+	ExpireAt int64             `json:"expire_at"`
+	Error    string            `json:"error"`
+}
+
+// Decode 启动外部进程解析源视频地址
+func (d *Decoder) Decode(url string) (*meta.DecodeResult, error) {
+	ec, ok := config.G.Decoder.CustomExec(url, d.name)
+	if !ok {
+		return nil, errors.Errorf("没有找到外部进程解析器的配置：%s", d.name)
+	}
+	input, err := json.Marshal(request{Name: d.name, Url: url, Options: ec.Options})
+	if err != nil {
+		return nil, errors.Wrap(err, "序列化解析请求失败")
+	}
+
+	timeout := DefaultTimeout
+	if ec.Timeout > 0 {
+		timeout = time.Duration(ec.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(appctx.Context(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ec.Command[0], ec.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := new(bytes.Buffer)
+	stderr := &stderrLogger{prefix: "[" + Prefix + d.name + "] "}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// 超时后外部进程的子进程可能仍然持有输出管道, 不再等待输出
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	stderr.Flush()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, errors.Errorf("外部进程解析超时：%v", timeout)
+	}
+	if err != nil {
+		if stderr.last != "" {
+			return nil, errors.Wrapf(err, "外部进程执行失败：%s", stderr.last)
+		}
+		return nil, errors.Wrap(err, "外部进程执行失败")
+	}
+	return parseResponse(stdout.Bytes())
+}
+
+// stderrLogger 将外部进程的标准错误逐行输出到日志, 并记录最后一个非空行作为失败原因
+type stderrLogger struct {
+	prefix string
+	buf    []byte
+	last   string
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush 输出缓冲区中最后一行没有换行符的内容
+func (l *stderrLogger) Flush() {
+	l.log(string(l.buf))
+	l.buf = nil
+}
+
+func (l *stderrLogger) log(line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	mylog.Info(l.prefix + line)
+	l.last = line
+}
+
+// parseResponse 将外部进程的响应转换为解析结果
+func parseResponse(output []byte) (*meta.DecodeResult, error) {
+	resp := new(response)
+	if err := json.Unmarshal(bytes.TrimSpace(output), resp); err != nil {
+		return nil, errors.Wrap(err, "外部进程的输出不是合法的 JSON")
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	res := &meta.DecodeResult{Resource: resp.Resource, Title: resp.Title, Meta: resp.Meta}
+	if resp.ExpireAt > 0 {
+		res.ExpireAt = time.Unix(resp.ExpireAt, 0)
+	}
+	for _, link := range resp.Links {
+		resp.Streams = append(resp.Streams, stream{Url: link})
+	}
+	for _, s := range resp.Streams {
+		if s.Url = strings.TrimSpace(s.Url); s.Url == "" {
+			continue
+		}
+		headers := make(map[string]string, len(resp.Headers)+len(s.Headers))
+		for k, v := range resp.Headers {
+			headers[k] = v
+		}
+		for k, v := range s.Headers {
+			headers[k] = v
+		}
+		res.Streams = append(res.Streams, meta.Stream{Url: s.Url, Role: s.Role, HeaderMap: headers})
+	}
+	if len(res.Streams) == 0 {
+		return nil, errors.New("外部进程没有返回任何下载地址")
+	}
+	return res, nil
+}
+
+// checkConfig 检查外部进程解析器的配置
+func checkConfig(dc *config.Decoder, allowEmpty bool) error {
+	for name, ec := range dc.Exec {
+		if len(ec.Command) == 0 || strings.TrimSpace(ec.Command[0]) == "" {
+			return errors.Errorf("外部进程解析器 %s 需要配置 command", name)
+		}
+		if ec.Timeout < 0 {
+			mylog.Warnf("外部进程解析器 %s 的超时时间配置错误：%d，使用默认值：%v", name, ec.Timeout, DefaultTimeout)
+			ec.Timeout = 0
+			dc.Exec[name] = ec
+		}
+	}
+
+	// 使用外部进程解析器时, 定制化配置可以引用全局配置中的解析器
+	for _, use := range dc.Uses() {
+		name, ok := strings.CutPrefix(use, Prefix)
+		if !ok {
+			continue
+		}
+		if _, ok = dc.Exec[name]; !ok {
+			if _, ok = config.G.Decoder.Exec[name]; !ok {
+				return errors.Errorf("没有找到外部进程解析器的配置：%s", name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package execdecoder_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/decoder"
+	"video-downloader-go/internal/decoder/execdecoder"
+	"video-downloader-go/internal/meta"
+)
+
+// useStub 将 script 写入临时目录, 并注册为名称为 name 的外部进程解析器
+//
+// @return 解析器以及脚本所在的目录
+func useStub(t *testing.T, name, script string, timeout int) (decoder.D, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试脚本依赖 sh")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, name+".sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if config.G.Decoder.Exec == nil {
+		config.G.Decoder.Exec = map[string]config.ExecDecoderConfig{}
+	}
+	config.G.Decoder.Exec[name] = config.ExecDecoderConfig{
+		Command: []string{"sh", path},
+		Timeout: timeout,
+		Options: map[string]any{"quality": "1080P"},
+	}
+	return decoder.GetDecoder(execdecoder.Prefix + name), dir
+}
+
+func TestDecodeLinks(t *testing.T) {
+	// 将请求写入脚本所在的目录, 用于检查传递给外部进程的内容
+	dcd, dir := useStub(t, "links", `
+cat > "$(dirname "$0")/req.json"
+echo "decoding" >&2
+echo '{"links": ["https://a.com/v.m3u8"], "headers": {"Referer": "https://a.com"}, "resource": "m3u8",
+  "title": "t", "meta": {"quality": "1080P"}, "expire_at": 4102444800}'
+`, 0)
+	res, err := dcd.Decode("https://a.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Streams) != 1 || res.Streams[0].Url != "https://a.com/v.m3u8" || res.Streams[0].HeaderMap["Referer"] != "https://a.com" {
+		t.Fatalf("媒体流异常: %+v", res.Streams)
+	}
+	if res.Resource != meta.ResourceM3U8 || res.Title != "t" || res.Meta["quality"] != "1080P" || !res.ExpireAt.Equal(time.Unix(4102444800, 0)) {
+		t.Fatalf("解析结果异常: %+v", res)
+	}
+	req, err := os.ReadFile(filepath.Join(dir, "req.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"name":"links"`, `"url":"https://a.com/page"`, `"quality":"1080P"`} {
+		if !strings.Contains(string(req), want) {
+			t.Fatalf("请求中缺少 %s: %s", want, req)
+		}
+	}
+}
+
+func TestDecodeStreams(t *testing.T) {
+	dcd, _ := useStub(t, "streams", `
+cat >/dev/null
+echo '{"headers": {"Referer": "r", "Cookie": "c"}, "streams": [
+  {"url": "https://a.com/v.mp4", "role": "video", "headers": {"Cookie": "v"}},
+  {"url": "https://a.com/a.m4a", "role": "audio"},
+  {"url": " "}
+]}'
+`, 0)
+	res, err := dcd.Decode("https://a.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Streams) != 2 || res.Streams[0].Role != meta.StreamVideo || res.Streams[1].Role != meta.StreamAudio {
+		t.Fatalf("媒体流异常: %+v", res.Streams)
+	}
+	// 媒体流自身的请求头覆盖共用的请求头
+	if h := res.Streams[0].HeaderMap; h["Cookie"] != "v" || h["Referer"] != "r" {
+		t.Fatalf("视频流的请求头异常: %v", h)
+	}
+	if h := res.Streams[1].HeaderMap; h["Cookie"] != "c" {
+		t.Fatalf("音频流的请求头异常: %v", h)
+	}
+}
+
+func TestDecodeFailure(t *testing.T) {
+	cases := []struct {
+		name, script, want string
+		timeout            int
+	}{
+		{"exit", "echo 'step 1' >&2\necho 'login required' >&2\nexit 3", "login required", 0},
+		{"error", `echo '{"error": "video removed"}'`, "video removed", 0},
+		{"empty", `echo '{"links": []}'`, "没有返回任何下载地址", 0},
+		{"invalid", `echo 'not json'`, "不是合法的 JSON", 0},
+		{"timeout", "sleep 5", "超时", 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dcd, _ := useStub(t, c.name, c.script, c.timeout)
+			_, err := dcd.Decode("https://a.com/page")
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("错误信息中缺少 %q: %v", c.want, err)
+			}
+		})
+	}
+}
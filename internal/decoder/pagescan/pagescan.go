@@ -0,0 +1,152 @@
+// 页面扫描解析器, 下载源视频页面并从 HTML 中查找 m3u8 或 mp4 地址
+//
+// 不执行页面中的脚本, 只能处理直接把播放地址写在页面中的网站, 通常作为其他解析器的备用解析器
+package pagescan
+
+import (
+	"context"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"video-downloader-go/internal/appctx"
+	"video-downloader-go/internal/decoder"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/myhttp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Name 解析器类型
+	Name = "page-scan"
+
+	// Timeout 请求页面的超时时间
+	Timeout = 30 * time.Second
+
+	// MaxPageSize 读取页面的最大字节数
+	MaxPageSize = 10 << 20
+
+	// UserAgent 请求页面时使用的 User-Agent, 部分网站不会给非浏览器返回播放地址
+	UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+var (
+	// absLinkRegex 匹配页面中的绝对地址, 兼容 JSON 中转义的斜杠
+	absLinkRegex = regexp.MustCompile(`https?:(?:\\?/){2}[^\s"'<>()]+?\.(?:m3u8|mp4)\b(?:\?(?:[^\s"'<>()\\]|\\[u/])*)?`)
+
+	// srcRegex 匹配 video 和 source 标签中的地址, 可以是相对地址
+	srcRegex = regexp.MustCompile(`(?i)<(?:video|source)\b[^>]*?\ssrc\s*=\s*["']([^"']+)["']`)
+
+	// titleRegex 匹配页面标题
+	titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+func init() {
+	decoder.Register(Name, func(string) decoder.D { return new(Decoder) }, decoder.Options{})
+}
+
+// Decoder 页面扫描解析器, 实现解析器接口
+type Decoder struct{}
+
+// Decode 下载源视频页面, 返回页面中的第一个 m3u8 地址, 没有 m3u8 地址时返回第一个 mp4 地址
+func (d *Decoder) Decode(pageUrl string) (*meta.DecodeResult, error) {
+	page, err := fetch(pageUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	links := scanLinks(pageUrl, page)
+	if len(links) == 0 {
+		return nil, errors.New("页面中没有找到视频地址")
+	}
+	link := links[0]
+	for _, l := range links {
+		if resourceOf(l) == meta.ResourceM3U8 {
+			link = l
+			break
+		}
+	}
+
+	res := meta.NewDecodeResult(link)
+	res.Resource = resourceOf(link)
+	res.Streams[0].HeaderMap = map[string]string{"Referer": pageUrl, "User-Agent": UserAgent}
+	if m := titleRegex.FindStringSubmatch(page); m != nil {
+		res.Title = strings.TrimSpace(html.UnescapeString(m[1]))
+	}
+	return res, nil
+}
+
+// fetch 请求页面并返回页面内容
+func fetch(pageUrl string) (string, error) {
+	ctx, cancel := context.WithTimeout(appctx.Context(), Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "构造请求失败")
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := myhttp.NewClient(nil, myhttp.ProfileOf(pageUrl)).Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "请求页面失败")
+	}
+	defer resp.Body.Close()
+	if !myhttp.Is2xxSuccess(resp.StatusCode) {
+		return "", errors.Errorf("请求页面失败, 响应码：%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxPageSize))
+	if err != nil {
+		return "", errors.Wrap(err, "读取页面失败")
+	}
+	return string(body), nil
+}
+
+// scanLinks 按照出现的顺序返回页面中去重后的视频地址
+func scanLinks(pageUrl, page string) []string {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	add := func(raw string) {
+		raw = strings.NewReplacer(`\/`, "/", `\u0026`, "&", `\u002F`, "/").Replace(raw)
+		u, err := base.Parse(html.UnescapeString(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		if link := u.String(); !seen[link] && resourceOf(link) != meta.ResourceUnknown {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, m := range srcRegex.FindAllStringSubmatch(page, -1) {
+		add(m[1])
+	}
+	for _, m := range absLinkRegex.FindAllString(page, -1) {
+		add(m)
+	}
+	return links
+}
+
+// resourceOf 根据地址的路径识别资源类型
+func resourceOf(link string) meta.ResourceType {
+	u, err := url.Parse(link)
+	if err != nil {
+		return meta.ResourceUnknown
+	}
+	path := strings.ToLower(u.Path)
+	switch {
+	case strings.HasSuffix(path, ".m3u8"):
+		return meta.ResourceM3U8
+	case strings.HasSuffix(path, ".mp4"):
+		return meta.ResourceMP4
+	}
+	return meta.ResourceUnknown
+}
@@ -0,0 +1,57 @@
+package pagescan_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"video-downloader-go/internal/decoder/pagescan"
+	"video-downloader-go/internal/meta"
+)
+
+func TestDecode(t *testing.T) {
+	pages := map[string]string{
+		// JSON 中转义的 m3u8 地址优先于 mp4 地址
+		"/json": `<html><head><title>Demo &amp; Video</title></head><body>
+<video src="/static/a.mp4"></video>
+<script>var player = {"url": "https:\/\/cdn.example.com\/v\/index.m3u8?token=1&e=2"};</script>
+</body></html>`,
+		// 只有相对地址时以页面地址为基准
+		"/relative": `<video controls><source src="media/b.mp4" type="video/mp4"></video>`,
+		"/empty":    `<p>no video here, see demo.mp4a</p>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+	dcd := new(pagescan.Decoder)
+
+	res, err := dcd.Decode(srv.URL + "/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Streams[0].Url; got != "https://cdn.example.com/v/index.m3u8?token=1&e=2" {
+		t.Fatalf("解析到的地址异常: %s", got)
+	}
+	if res.Resource != meta.ResourceM3U8 || res.Title != "Demo & Video" || res.Streams[0].HeaderMap["Referer"] != srv.URL+"/json" {
+		t.Fatalf("解析结果异常: %+v", res)
+	}
+
+	res, err = dcd.Decode(srv.URL + "/relative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Streams[0].Url; got != srv.URL+"/media/b.mp4" || res.Resource != meta.ResourceMP4 {
+		t.Fatalf("相对地址解析异常: %s", got)
+	}
+
+	for _, path := range []string{"/empty", "/missing"} {
+		if _, err = dcd.Decode(srv.URL + path); err == nil {
+			t.Fatalf("%s 应该解析失败", path)
+		}
+	}
+}
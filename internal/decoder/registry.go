@@ -0,0 +1,72 @@
+// 解析器注册表, 每种解析器在各自的包中通过 init 注册, 内置的解析器由 decoder/all 包统一导入
+
+package decoder
+
+import (
+	"sync"
+	"video-downloader-go/internal/config"
+)
+
+// Factory 创建一个解析器实例, name 为任务实际使用的解析器类型, 如 exec:foo
+type Factory func(name string) D
+
+// Options 解析器的配置校验以及能力声明
+type Options struct {
+	Interactive bool                // 解析时可能需要在控制台中输入, 没有单独配置并发数时同一时间只解析一个任务, 避免等待输入的任务占满解析位置
+	MultiStream bool                // 可能返回音视频分离的多个媒体流, 没有声明时解析结果只能包含一个音视频流
+	NeedBrowser bool                // 解析时需要启动浏览器, 没有单独配置并发数时同一时间只解析一个任务
+	Check       config.DecoderCheck // 校验解析器自身的配置, 可以为空
+}
+
+// registration 一个已注册的解析器
+type registration struct {
+	factory Factory
+	opts    Options
+}
+
+var (
+	registry  = map[string]*registration{} // 注册的解析器类型 => 注册信息
+	instances = map[string]D{}             // 实际使用的解析器类型 => 解析器实例
+	instMu    sync.Mutex
+)
+
+// Register 注册一个解析器类型, 只能在 init 中调用
+//
+// 类型以 config.DecoderFamilySuffix 结尾时注册的是一组解析器, 如 exec:* 可以匹配 exec:foo;
+// 解析器实例在第一次使用时通过 factory 创建, 每个类型只有一个实例, 会被多个解析协程并发调用,
+// 因此解析器不能保存解析过程中的状态; 类型重复时 panic
+func Register(name string, factory Factory, opts Options) {
+	config.RegisterDecoder(name, opts.Check)
+	registry[name] = &registration{factory: factory, opts: opts}
+}
+
+// lookup 返回解析器类型匹配的注册信息
+func lookup(name string) (*registration, bool) {
+	reg, ok := registry[config.DecoderTypeOf(name)]
+	return reg, ok
+}
+
+// Lookup 返回已注册的解析器的能力声明
+func Lookup(name string) (Options, bool) {
+	reg, ok := lookup(name)
+	if !ok {
+		return Options{}, false
+	}
+	return reg.opts, true
+}
+
+// GetDecoder 根据传递的解析器类型返回一个解析器对象, 类型未注册时返回 nil
+func GetDecoder(use string) D {
+	reg, ok := lookup(use)
+	if !ok {
+		return nil
+	}
+	instMu.Lock()
+	defer instMu.Unlock()
+	dcd, ok := instances[use]
+	if !ok {
+		dcd = reg.factory(use)
+		instances[use] = dcd
+	}
+	return dcd
+}
@@ -0,0 +1,114 @@
+package decoder_test
+
+import (
+	"slices"
+	"testing"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/decoder"
+	_ "video-downloader-go/internal/decoder/all"
+	"video-downloader-go/internal/meta"
+)
+
+type stubDecoder struct{}
+
+func (*stubDecoder) Decode(url string) (*meta.DecodeResult, error) {
+	return meta.NewDecodeResult(url), nil
+}
+
+func TestRegister(t *testing.T) {
+	created := 0
+	decoder.Register("stub", func(string) decoder.D {
+		created++
+		return new(stubDecoder)
+	}, decoder.Options{MultiStream: true})
+
+	if !slices.Contains(config.DecoderTypes(), "stub") {
+		t.Fatalf("注册的解析器类型没有登记到配置中: %v", config.DecoderTypes())
+	}
+	if opts, ok := decoder.Lookup("stub"); !ok || !opts.MultiStream {
+		t.Fatalf("解析器的能力声明异常: %v, %v", opts, ok)
+	}
+
+	// 解析器实例只创建一次
+	if decoder.GetDecoder("stub") != decoder.GetDecoder("stub") || created != 1 {
+		t.Fatalf("解析器实例被重复创建: %d", created)
+	}
+	if decoder.GetDecoder("unknown") != nil {
+		t.Fatal("未注册的解析器类型应该返回 nil")
+	}
+
+	// 重复注册时 panic
+	defer func() {
+		if recover() == nil {
+			t.Fatal("重复注册时应该 panic")
+		}
+	}()
+	decoder.Register("stub", func(string) decoder.D { return new(stubDecoder) }, decoder.Options{})
+}
+
+func TestBuiltinOptions(t *testing.T) {
+	// 需要在控制台中手动选择的解析器
+	for _, name := range []string{"youtube-dl", "cat-catch:tx", "cat-catch:mg"} {
+		if opts, ok := decoder.Lookup(name); !ok || !opts.Interactive {
+			t.Errorf("解析器 %s 应该声明为需要控制台输入: %v, %v", name, opts, ok)
+		}
+	}
+	if opts, _ := decoder.Lookup("page-scan"); opts.Interactive {
+		t.Error("page-scan 解析器不需要控制台输入")
+	}
+}
+
+type namedDecoder struct{ name string }
+
+func (*namedDecoder) Decode(url string) (*meta.DecodeResult, error) {
+	return meta.NewDecodeResult(url), nil
+}
+
+func TestRegisterFamily(t *testing.T) {
+	decoder.Register("family:"+config.DecoderFamilySuffix, func(name string) decoder.D {
+		return &namedDecoder{name: name}
+	}, decoder.Options{})
+
+	if got := config.DecoderTypeOf("family:a"); got != "family:*" {
+		t.Fatalf("解析器类型没有匹配到注册的一组解析器: %q", got)
+	}
+	if got := config.DecoderTypeOf("family"); got != "" {
+		t.Fatalf("缺少名称的解析器类型不应该匹配: %q", got)
+	}
+
+	// 同一组中不同名称的解析器使用各自的实例
+	a, b := decoder.GetDecoder("family:a"), decoder.GetDecoder("family:b")
+	if a == nil || a == b || a != decoder.GetDecoder("family:a") {
+		t.Fatal("同一组解析器的实例异常")
+	}
+	if a.(*namedDecoder).name != "family:a" {
+		t.Fatalf("创建解析器时传递的类型异常: %s", a.(*namedDecoder).name)
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	decoder.Register("single", func(string) decoder.D { return new(stubDecoder) }, decoder.Options{})
+	decoder.Register("multi", func(string) decoder.D { return new(stubDecoder) }, decoder.Options{MultiStream: true})
+
+	res := &meta.DecodeResult{Streams: []meta.Stream{
+		{Url: "https://a.com/v.mp4", Role: meta.StreamVideo},
+		{Url: "https://a.com/a.m4a", Role: meta.StreamAudio},
+		{Url: "https://a.com/zh.vtt", Role: meta.StreamSubtitle},
+	}}
+	if err := decoder.CheckResult(res, "multi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.CheckResult(res, "single"); err == nil {
+		t.Fatal("没有声明 MultiStream 的解析器不能返回多个音视频流")
+	}
+
+	// 字幕流不计入音视频流
+	res.Streams = res.Streams[1:]
+	if err := decoder.CheckResult(res, "single"); err != nil {
+		t.Fatal(err)
+	}
+	res.Streams = res.Streams[1:]
+	if err := decoder.CheckResult(res, "multi"); err == nil {
+		t.Fatal("只有字幕流的解析结果应该校验失败")
+	}
+}
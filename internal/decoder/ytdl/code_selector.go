@@ -242,13 +242,14 @@ func (cs *CodeSelector) ExecuteProcess() error {
 	if ccf != "" && ccf != config.YoutubeDlCookieNone {
 		commands = append(commands, "--cookies-from-browser", ccf)
 	}
+	commands = appendProxyArgs(commands, cs.Url)
 
 	// 执行命令
 	cmd := exec.Command(config.YoutubeDlPath, commands...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("执行命令失败: %v, cmd: [%s %s]", err, config.YoutubeDlPath, strings.Join(commands, " "))
+		return fmt.Errorf("执行命令失败: %v, cmd: [%s %s]", err, config.YoutubeDlPath, redactCommands(commands))
 	}
 
 	cs.PrintFormatCodes(mystring.UTF8(string(output)))
@@ -12,6 +12,7 @@ import (
 type Handler struct {
 	cmd        *exec.Cmd // 命令行命令
 	eptUrlNums int       // 预期将会解析出来的链接个数
+	title      string    // 解析出来的视频标题, 调用 GetLinks 之后可用
 }
 
 // NewHandler 用于创建一个 youtube-dl 的处理器
@@ -21,6 +22,7 @@ func NewHandler(url string, formatCode *config.YtDlFormatCode) *Handler {
 	commands := []string{
 		"-f", formatCode.Code,
 		url,
+		"--get-title",
 		"--get-url",
 		"--no-playlist",
 	}
@@ -29,6 +31,7 @@ func NewHandler(url string, formatCode *config.YtDlFormatCode) *Handler {
 	if ccf != "" && ccf != config.YoutubeDlCookieNone {
 		commands = append(commands, "--cookies-from-browser", ccf)
 	}
+	commands = appendProxyArgs(commands, url)
 
 	ydh.cmd = exec.Command(config.YoutubeDlPath, commands...)
 	return ydh
@@ -41,13 +44,17 @@ func (ydh *Handler) GetLinks() ([]string, error) {
 		return nil, errors.Wrap(err, "获取命令行输出失败")
 	}
 
-	// 逐行读取链接
+	// 逐行读取链接, 标题在链接之前输出, 跳过混在输出中的日志行
 	links := []string{}
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 	for scanner.Scan() {
 		l := scanner.Text()
 		if strings.HasPrefix(l, "http") {
 			links = append(links, l)
+			continue
+		}
+		if ydh.title == "" && len(links) == 0 && !isLogLine(l) {
+			ydh.title = strings.TrimSpace(l)
 		}
 	}
 	if err = scanner.Err(); err != nil {
@@ -60,3 +67,14 @@ func (ydh *Handler) GetLinks() ([]string, error) {
 
 	return links, nil
 }
+
+// Title 返回解析出来的视频标题, 需要在 GetLinks 成功之后调用
+func (ydh *Handler) Title() string {
+	return ydh.title
+}
+
+// isLogLine 判断 youtube-dl 的输出行是否为日志, 如 WARNING: ..., [youtube] ...
+func isLogLine(line string) bool {
+	l := strings.TrimSpace(line)
+	return l == "" || strings.HasPrefix(l, "[") || strings.HasPrefix(l, "WARNING:") || strings.HasPrefix(l, "ERROR:")
+}
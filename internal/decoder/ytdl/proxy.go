@@ -0,0 +1,36 @@
+package ytdl
+
+import (
+	"net/url"
+	"strings"
+	"video-downloader-go/internal/config"
+)
+
+// appendProxyArgs 根据源视频地址追加 --proxy 参数
+//
+// 配置了代理但该地址不使用代理时传入空字符串, 避免 yt-dlp 使用环境变量中的代理
+func appendProxyArgs(commands []string, pageUrl string) []string {
+	proxy := config.G.Proxy.CustomProxy(pageUrl)
+	if !proxy.Enabled() {
+		return commands
+	}
+	if u := proxy.RawURL(pageUrl); u != nil {
+		return append(commands, "--proxy", u.String())
+	}
+	return append(commands, "--proxy", "")
+}
+
+// redactCommands 隐藏命令参数中代理地址的密码, 用于输出日志
+func redactCommands(commands []string) string {
+	ans := make([]string, len(commands))
+	copy(ans, commands)
+	for i := 1; i < len(ans); i++ {
+		if ans[i-1] != "--proxy" {
+			continue
+		}
+		if u, err := url.Parse(ans[i]); err == nil {
+			ans[i] = u.Redacted()
+		}
+	}
+	return strings.Join(ans, " ")
+}
@@ -0,0 +1,55 @@
+package ytdl
+
+import (
+	"fmt"
+	"strings"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/decoder"
+
+	"github.com/pkg/errors"
+)
+
+// Name 解析器类型
+const Name = "youtube-dl"
+
+func init() {
+	decoder.Register(Name, func(string) decoder.D { return new(Decoder) }, decoder.Options{
+		Interactive: true,
+		MultiStream: true,
+		Check:       checkConfig,
+	})
+}
+
+// checkConfig 检查 youtube-dl 解析器的配置
+func checkConfig(dc *config.Decoder, allowEmpty bool) error {
+	// 1 检查 format code
+	if err := checkFormatCodes(&dc.YoutubeDL); err != nil {
+		return errors.Wrap(err, "检查 format code 失败")
+	}
+
+	// 2 设置默认的 cookie 来源
+	dc.YoutubeDL.CookiesFrom = strings.TrimSpace(dc.YoutubeDL.CookiesFrom)
+	if dc.YoutubeDL.CookiesFrom == "" {
+		dc.YoutubeDL.CookiesFrom = config.YoutubeDlCookieNone
+	}
+
+	// 3 检查记住视频格式配置
+	if !dc.YoutubeDL.IsRememberFormatValid() && !allowEmpty {
+		return errors.New("remember format 配置错误，可选值: -1, 1")
+	}
+	return nil
+}
+
+// checkFormatCodes 检查并封装 format code
+func checkFormatCodes(yc *config.YoutubeDlConfig) error {
+	formatCodes := []*config.YtDlFormatCode{}
+	for _, raw := range yc.RawFormatCodes {
+		cs := strings.Split(raw, "+")
+		if len(cs) != 1 && len(cs) != 2 {
+			return errors.New(fmt.Sprintf("不合法的 format code：%v，示例：137+140", raw))
+		}
+		formatCodes = append(formatCodes, &config.YtDlFormatCode{Code: raw, ExpectedLinkNums: len(cs)})
+	}
+	yc.FormatCodes = formatCodes
+	return nil
+}
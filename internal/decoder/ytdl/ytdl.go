@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
 	"video-downloader-go/internal/util/mylog/color"
 
@@ -18,12 +19,49 @@ const (
 // Decoder 是一个使用 youtube-dl 工具来进行解析的解析器
 type Decoder struct{}
 
-// FetchDownloadLinks 是核心解析方法，实现接口 D
-func (d *Decoder) FetchDownloadLinks(url string) ([]string, error) {
+// Decode 是核心解析方法，实现接口 D
+func (d *Decoder) Decode(url string) (*meta.DecodeResult, error) {
+	f, err := d.fetchLinks(url)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(f), nil
+}
+
+// fetched 是一次成功解析的结果
+type fetched struct {
+	links []string // 下载地址
+	title string   // 视频标题
+	code  string   // 解析成功的 format code
+}
+
+// newResult 将 youtube-dl 返回的下载地址封装为解析结果
+//
+// 使用 [视频编码+音频编码] 格式解析时, 按照顺序返回视频流和音频流,
+// 视频标题作为文件名模板变量 title, 解析成功的 format code 作为文件名模板变量 quality
+func newResult(f *fetched) *meta.DecodeResult {
+	res := &meta.DecodeResult{Title: f.title, Meta: map[string]string{"quality": f.code}}
+	if len(f.links) == 1 {
+		res.Streams = []meta.Stream{{Url: f.links[0], Role: meta.StreamMuxed}}
+		return res
+	}
+	roles := []meta.StreamRole{meta.StreamVideo, meta.StreamAudio}
+	for i, link := range f.links {
+		role := meta.StreamMuxed
+		if i < len(roles) {
+			role = roles[i]
+		}
+		res.Streams = append(res.Streams, meta.Stream{Url: link, Role: role})
+	}
+	return res
+}
+
+// fetchLinks 解析并获取下载链接列表, 预置的 format code 全部失败时让用户手动选择
+func (d *Decoder) fetchLinks(url string) (*fetched, error) {
 	codes := config.G.Decoder.YoutubeDL.CustomFormatCodes(url)
 	// 1 尝试配置文件中配置的 format
-	if links, err := d.tryLinks(url, codes); err == nil {
-		return links, nil
+	if f, err := d.tryLinks(url, codes); err == nil {
+		return f, nil
 	}
 
 	// 2 尝试用户手动输入的 format
@@ -38,11 +76,7 @@ func (d *Decoder) FetchDownloadLinks(url string) ([]string, error) {
 	}
 
 	// 4 使用获取到的 format code 请求视频下载地址
-	links, err := d.tryLinks(url, []*config.YtDlFormatCode{code})
-	if err != nil {
-		return nil, err
-	}
-	return links, nil
+	return d.tryLinks(url, []*config.YtDlFormatCode{code})
 }
 
 // tryCode 调用 youtube-dl 获取 format code, 并允许重试 RetryTime 次
@@ -61,14 +95,15 @@ func (d *Decoder) tryCode(url string) (*config.YtDlFormatCode, error) {
 }
 
 // tryLinks 负责解析下载链接，并允许重试 RetryTime 次
-func (d *Decoder) tryLinks(url string, codes []*config.YtDlFormatCode) ([]string, error) {
+func (d *Decoder) tryLinks(url string, codes []*config.YtDlFormatCode) (*fetched, error) {
 	for _, code := range codes {
 		currentTry := 1
 		for currentTry <= RetryTime {
 			mylog.Infof("尝试解析地址：%s, format code: %s, 第 %d 次尝试...", url, code.Code, currentTry)
-			links, err := NewHandler(url, code).GetLinks()
+			h := NewHandler(url, code)
+			links, err := h.GetLinks()
 			if err == nil {
-				return links, nil
+				return &fetched{links: links, title: h.Title(), code: code.Code}, nil
 			}
 			currentTry++
 			time.Sleep(time.Second)
@@ -0,0 +1,35 @@
+// 下载完成后的容器检查
+
+package downloader
+
+import (
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/transfer"
+	"video-downloader-go/internal/util/mylog"
+)
+
+// fitContainer 探测下载完成的文件, 当文件实际的封装格式与后缀不符,
+// 或者编码无法放入后缀对应的容器时, 重新封装到兼容的容器中
+func fitContainer(dmt *meta.Download) error {
+	pr, err := ffmpeg.Probe(dmt.FileName)
+	if err != nil {
+		// 无法解析的文件交给校验阶段处理
+		mylog.Warnf("读取文件信息失败, 跳过容器检查: %v", err)
+		return nil
+	}
+
+	want := transfer.ContainerOf(dmt.FileName)
+	target := transfer.FitContainer(want, pr.Streams)
+	if target == want && transfer.FormatMatches(want, pr.Format) {
+		return nil
+	}
+
+	dst := transfer.ReplaceContainer(dmt.FileName, target)
+	mylog.Warnf("文件的封装格式 (%s) 与 %s 容器不符, 重新封装为: %s", pr.Format, want, dst)
+	if err = transfer.Remux(dmt.FileName, dst, pr.Duration, dmt.LogBar); err != nil {
+		return err
+	}
+	dmt.FileName = dst
+	return nil
+}
@@ -2,7 +2,11 @@
 
 package coredl
 
-import "video-downloader-go/internal/meta"
+import (
+	"video-downloader-go/internal/appctx"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mysemaphore"
+)
 
 type Downloader interface {
 	// Exec 是下载器的核心处理方法
@@ -43,3 +47,18 @@ func NewMp4Simple() Downloader {
 func NewMp4MultiThread() Downloader {
 	return new(mp4MultiThreadDownloader)
 }
+
+// acquireLimiter 占用一个分片下载位置, limiter 为空时不限制
+func acquireLimiter(limiter *mysemaphore.Semaphore) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Acquire(appctx.Context())
+}
+
+// releaseLimiter 释放分片下载位置
+func releaseLimiter(limiter *mysemaphore.Semaphore) {
+	if limiter != nil {
+		limiter.Release()
+	}
+}
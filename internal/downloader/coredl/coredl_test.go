@@ -4,6 +4,7 @@ import (
 	"testing"
 	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/downloader/coredl"
 	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util/mylog"
@@ -9,10 +9,11 @@ import (
 	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/downloader/dlpool"
 	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/transfer"
 	"video-downloader-go/internal/util"
 	"video-downloader-go/internal/util/m3u8"
 	"video-downloader-go/internal/util/myfile"
-	"video-downloader-go/internal/util/myhttp"
+	"video-downloader-go/internal/util/mysemaphore"
 
 	"github.com/pkg/errors"
 )
@@ -39,8 +40,8 @@ func (d *m3u8MultiThreadDownloader) Exec(dmt *meta.Download, handlerFunc Progres
 func downloadM3U8(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bool) error {
 	var current, total, currentBytes int64
 	// 1 读取 ts 文件
-	dmt.HeaderMap = myhttp.GenDefaultHeaderMapByUrl(dmt.HeaderMap, dmt.Link)
-	tsMetas, err := m3u8.ReadTsUrls(dmt.Link, dmt.HeaderMap)
+	client := dmt.Client()
+	tsMetas, err := m3u8.ReadTsUrlsWithClient(dmt.Link, dmt.HeadersOf(dmt.Link), client)
 	if err != nil {
 		dmt.LogBar.ErrorHint("读取 m3u8 异常")
 		return errors.Wrapf(err, "读取 ts 文件失败，file: %v", dmt.FileName)
@@ -59,12 +60,13 @@ func downloadM3U8(dmt *meta.Download, handlerFunc ProgressHandler, multiThread b
 		TotalTasks:   1,
 	})
 	// 2 初始化临时文件夹
-	tempDirPath, err := myfile.InitTempTsDir(dmt.FileName, config.G.Downloader.TsDirSuffix)
+	tempDirPath, err := myfile.InitTempTsDir(dmt.FileName, config.G.Downloader.CustomTsDirSuffix(dmt.OriginUrl))
 	if err != nil {
 		dmt.LogBar.ErrorHint("初始化分片目录失败")
 		return errors.Wrapf(err, "初始化临时 ts 文件夹失败，file: %v", dmt.FileName)
 	}
 	// 3 执行下载
+	bucket := config.G.Downloader.CustomBucket(dmt.OriginUrl)
 	downloadTsMeta := func(tmt *m3u8.TsMeta) {
 		// 通过外部函数的 err 对象来传递错误
 		var tmpErr error
@@ -72,8 +74,9 @@ func downloadM3U8(dmt *meta.Download, handlerFunc ProgressHandler, multiThread b
 			err = util.AnyError(err, tmpErr)
 		}()
 
-		tsPath := filepath.Join(tempDirPath, fmt.Sprintf(TsFilenameFormat, tmt.Index))
-		th := NewTsHandler(tmt, tsPath, dmt.HeaderMap)
+		tsPath := tsFilePath(tempDirPath, tmt.Index)
+		th := NewTsHandler(tmt, tsPath, dmt.HeadersOf(tmt.Url))
+		th.Bucket, th.Client = bucket, client
 
 		var dn int64
 		if dn, tmpErr = th.Download(); tmpErr != nil {
@@ -94,7 +97,7 @@ func downloadM3U8(dmt *meta.Download, handlerFunc ProgressHandler, multiThread b
 		})
 	}
 	if multiThread {
-		err = util.AnyError(err, handleTsMetasMultiThread(tsMetas, downloadTsMeta))
+		err = util.AnyError(err, handleTsMetasMultiThread(tsMetas, config.G.Downloader.CustomLimiter(dmt.OriginUrl), downloadTsMeta))
 	} else {
 		handleTsMetasSimple(tsMetas, downloadTsMeta)
 	}
@@ -102,14 +105,28 @@ func downloadM3U8(dmt *meta.Download, handlerFunc ProgressHandler, multiThread b
 		dmt.LogBar.ErrorHint("m3u8 下载失败")
 		return errors.Wrap(err, "m3u8 下载失败")
 	}
-	// 4 合并文件
-	if err = m3u8.Merge(tempDirPath, dmt); err != nil {
+	// 4 合并文件, 分片顺序以 m3u8 中的序号为准
+	segments := make([]transfer.Segment, len(tsMetas))
+	for i, tmt := range tsMetas {
+		segments[i] = transfer.Segment{
+			Index:    tmt.Index,
+			Path:     tsFilePath(tempDirPath, tmt.Index),
+			Duration: tmt.Duration,
+		}
+	}
+	dmt.ExpectedDuration = transfer.TotalDuration(segments)
+	if err = m3u8.Merge(tempDirPath, segments, dmt); err != nil {
 		dmt.LogBar.ErrorHint("合并分片失败")
 		return errors.Wrap(err, "合并 ts 文件失败")
 	}
 	return nil
 }
 
+// tsFilePath 生成第 index 个分片在临时目录中的保存路径
+func tsFilePath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf(TsFilenameFormat, index))
+}
+
 // 单协程下载 ts 文件
 func handleTsMetasSimple(tsMetas []*m3u8.TsMeta, downloadFunc func(*m3u8.TsMeta)) {
 	if len(tsMetas) == 0 {
@@ -121,7 +138,8 @@ func handleTsMetasSimple(tsMetas []*m3u8.TsMeta, downloadFunc func(*m3u8.TsMeta)
 }
 
 // 多协程下载 ts 文件
-func handleTsMetasMultiThread(tsMetas []*m3u8.TsMeta, downloadFunc func(*m3u8.TsMeta)) (err error) {
+// limiter 限制同时下载的分片数, 为空时只受协程池大小限制
+func handleTsMetasMultiThread(tsMetas []*m3u8.TsMeta, limiter *mysemaphore.Semaphore, downloadFunc func(*m3u8.TsMeta)) (err error) {
 	if len(tsMetas) == 0 {
 		return nil
 	}
@@ -129,16 +147,22 @@ func handleTsMetasMultiThread(tsMetas []*m3u8.TsMeta, downloadFunc func(*m3u8.Ts
 	var wg sync.WaitGroup
 	for _, tmt := range tsMetas {
 		copyMt := tmt
+		if e := acquireLimiter(limiter); e != nil {
+			wg.Wait()
+			return e
+		}
 		wg.Add(1)
 
 		err = dlpool.SubmitDownload(func() {
 			defer wg.Done()
+			defer releaseLimiter(limiter)
 			if err == nil {
 				downloadFunc(copyMt)
 			}
 		})
 
 		if err != nil {
+			releaseLimiter(limiter)
 			return errors.Wrap(err, "协程池异常，请检查配置")
 		}
 	}
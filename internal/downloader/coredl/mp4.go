@@ -9,11 +9,14 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/downloader/dlpool"
 	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/util"
+	"video-downloader-go/internal/util/myfile"
 	"video-downloader-go/internal/util/myhttp"
 	"video-downloader-go/internal/util/mymath"
+	"video-downloader-go/internal/util/mysemaphore"
 
 	"github.com/pkg/errors"
 )
@@ -46,7 +49,7 @@ func (d *mp4MultiThreadDownloader) Exec(dmt *meta.Download, handlerFunc Progress
 func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bool) (err error) {
 	var current, total, currentBytes, totalBytes int64
 	// 1 获取文件总大小
-	ranges, err := myhttp.GetRequestRangesFrom(dmt.Link, http.MethodGet, myhttp.GenDefaultHeaderMapByUrl(nil, dmt.Link), 0)
+	ranges, err := myhttp.GetRequestRangesFrom(dmt.Link, http.MethodGet, dmt.HeadersOf(dmt.Link), 0, dmt.Client())
 	if err != nil {
 		if util.IsRetryableError(err) {
 			time.Sleep(time.Second * 2)
@@ -60,7 +63,12 @@ func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bo
 		dmt.LogBar.ErrorHint("空文件, 无法下载")
 		return errors.New("空文件，停止下载")
 	}
-	// 2 分片
+	// 2 清空目标文件, 分片按照偏移量写入, 残留的旧内容会与新内容交错
+	if err = myfile.CreateEmpty(dmt.FileName); err != nil {
+		dmt.LogBar.ErrorHint("无法创建目标文件")
+		return errors.Wrap(err, "无法创建目标文件")
+	}
+	// 3 分片
 	tasks := initUnitTasks(totalBytes)
 	total = int64(len(tasks))
 	// 调用一次监听器，使得调用方可以获得文件的总大小
@@ -72,8 +80,8 @@ func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bo
 		CurrentTask:  1,
 		TotalTasks:   1,
 	})
-	// 3 循环分片进行下载
-	defaultHeaders := myhttp.GenDefaultHeaderMapByUrl(nil, dmt.Link)
+	// 4 循环分片进行下载
+	defaultHeaders := dmt.HeadersOf(dmt.Link)
 	// 构造请求，携带上分片头
 	req, err := http.NewRequest(http.MethodGet, dmt.Link, nil)
 	if err != nil {
@@ -82,6 +90,7 @@ func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bo
 	for k, v := range defaultHeaders {
 		req.Header.Add(k, v)
 	}
+	bucket, client := config.G.Downloader.CustomBucket(dmt.OriginUrl), dmt.Client()
 	downloadTask := func(task *unitTask) {
 		var tmpErr error
 		defer func() {
@@ -96,7 +105,7 @@ func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bo
 		}
 		newReq.Header.Set(myhttp.HttpHeaderRangesKey, fmt.Sprintf("bytes=%d-%d", task.from, task.to))
 		var dn int64
-		if dn, tmpErr = myhttp.DownloadWithRateLimitV2(newReq, dmt.FileName); tmpErr != nil {
+		if dn, tmpErr = myhttp.DownloadWithBucket(newReq, dmt.FileName, bucket, client); tmpErr != nil {
 			tmpErr = errors.Wrapf(tmpErr, "下载分片时出现异常：%v, %v", dmt, task)
 			return
 		}
@@ -113,7 +122,7 @@ func downloadMp4(dmt *meta.Download, handlerFunc ProgressHandler, multiThread bo
 		})
 	}
 	if multiThread {
-		err = util.AnyError(err, handleTasksMultiThread(tasks, downloadTask))
+		err = util.AnyError(err, handleTasksMultiThread(tasks, config.G.Downloader.CustomLimiter(dmt.OriginUrl), downloadTask))
 	} else {
 		handleTasksSimple(tasks, downloadTask)
 	}
@@ -131,7 +140,8 @@ func handleTasksSimple(tasks []*unitTask, downloadTaskFunc func(*unitTask)) {
 }
 
 // 多协程处理任务列表
-func handleTasksMultiThread(tasks []*unitTask, downloadTaskFunc func(*unitTask)) (err error) {
+// limiter 限制同时下载的分片数, 为空时只受协程池大小限制
+func handleTasksMultiThread(tasks []*unitTask, limiter *mysemaphore.Semaphore, downloadTaskFunc func(*unitTask)) (err error) {
 	if len(tasks) == 0 {
 		return
 	}
@@ -140,16 +150,22 @@ func handleTasksMultiThread(tasks []*unitTask, downloadTaskFunc func(*unitTask))
 	for _, task := range tasks {
 		// 在 for-range 结构中使用多协程时需要拷贝指针
 		copyTask := task
+		if e := acquireLimiter(limiter); e != nil {
+			wg.Wait()
+			return e
+		}
 		wg.Add(1)
 
 		err = dlpool.SubmitDownload(func() {
 			defer wg.Done()
+			defer releaseLimiter(limiter)
 			if err == nil {
 				downloadTaskFunc(copyTask)
 			}
 		})
 
 		if err != nil {
+			releaseLimiter(limiter)
 			return errors.Wrap(err, "协程池运行异常，请检查配置")
 		}
 	}
@@ -4,24 +4,26 @@ package coredl
 import (
 	"fmt"
 	"net/http"
-	"os/exec"
 	"path/filepath"
 	"time"
-	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/util"
 	"video-downloader-go/internal/util/m3u8"
 	"video-downloader-go/internal/util/myfile"
 	"video-downloader-go/internal/util/myhttp"
 	"video-downloader-go/internal/util/mylog"
+	"video-downloader-go/internal/util/mytokenbucket"
 
 	"github.com/pkg/errors"
 )
 
 // Ts 文件处理器
 type TsHandler struct {
-	m3u8.TsMeta                   // ts 文件下载信息
-	DlPath      string            // ts 文件保存的绝对路径
-	Headers     map[string]string // 请求头
+	m3u8.TsMeta                              // ts 文件下载信息
+	DlPath      string                       // ts 文件保存的绝对路径
+	Headers     map[string]string            // 请求头
+	Bucket      *mytokenbucket.MyTokenBucket // 限速使用的令牌桶, 为空时使用全局令牌桶
+	Client      *http.Client                 // 发送请求的客户端, 为空时使用 TimeoutHttpClient
 
 	valid       bool   // 当前处理器是否有效
 	headless    bool   // 是否是无头下载
@@ -56,6 +58,14 @@ func NewTsHandler(tmt *m3u8.TsMeta, dlPath string, headers map[string]string) *T
 	return th
 }
 
+// bucket 返回限速使用的令牌桶
+func (th *TsHandler) bucket() *mytokenbucket.MyTokenBucket {
+	if th.Bucket == nil {
+		return mytokenbucket.GlobalBucket
+	}
+	return th.Bucket
+}
+
 // Download 执行下载逻辑
 func (th *TsHandler) Download() (int64, error) {
 	if !th.valid {
@@ -90,7 +100,7 @@ func (th *TsHandler) downloadAndMergeHead() (int64, error) {
 	if err != nil {
 		return -1, err
 	}
-	headDn, err := myhttp.DownloadWithRateLimitV2(req, filepath.Join(dlDir, th.tmpHeadName))
+	headDn, err := myhttp.DownloadWithBucket(req, filepath.Join(dlDir, th.tmpHeadName), th.bucket(), th.Client)
 	if err != nil {
 		return -1, errors.Wrapf(err, "分片下载异常: %v", th.DlPath)
 	}
@@ -100,7 +110,7 @@ func (th *TsHandler) downloadAndMergeHead() (int64, error) {
 	if err != nil {
 		return -1, err
 	}
-	bodyDn, err := myhttp.DownloadWithRateLimitV2(req, filepath.Join(dlDir, th.tmpBodyName))
+	bodyDn, err := myhttp.DownloadWithBucket(req, filepath.Join(dlDir, th.tmpBodyName), th.bucket(), th.Client)
 	if err != nil {
 		return -1, errors.Wrapf(err, "分片下载异常: %v", th.DlPath)
 	}
@@ -125,8 +135,13 @@ func (th *TsHandler) downloadHeadless() (int64, error) {
 		return -1, err
 	}
 
+	// 临时目录可能是上一次下载残留的, 先清空分片文件
+	if err = myfile.CreateEmpty(th.DlPath); err != nil {
+		return -1, err
+	}
+
 	var dn int64
-	if dn, err = myhttp.DownloadWithRateLimitV2(req, th.DlPath); err != nil {
+	if dn, err = myhttp.DownloadWithBucket(req, th.DlPath, th.bucket(), th.Client); err != nil {
 		return -1, errors.Wrapf(err, "分片下载异常：%v", th.DlPath)
 	}
 
@@ -155,17 +170,20 @@ func (th *TsHandler) buildRequestWithHeaders(head bool) (*http.Request, error) {
 }
 
 // mergeHeadAndBody 使用 ffmpeg 将 ts 头部和主体合并到一起
+//
+// 合并的是单个分片, 与其他分片的下载同时进行, 耗时很短, 不向任务条输出进度,
+// 否则会覆盖任务条上的下载进度; 失败时 ffmpeg 的错误输出包含在返回的错误中
 func (th *TsHandler) mergeHeadAndBody() error {
 	// 1 构建命令
-	cmd := exec.Command(
-		config.FfmpegPath,
+	cmd := ffmpeg.Command(
+		"-y",
 		"-i", fmt.Sprintf("concat:%s|%s", filepath.Join(th.dlDir, th.tmpHeadName), filepath.Join(th.dlDir, th.tmpBodyName)),
 		"-c", "copy",
 		th.DlPath,
 	)
 
-	// 2 执行合并
-	if _, err := cmd.CombinedOutput(); err != nil {
+	// 2 执行合并, 不输出进度
+	if err := ffmpeg.RunWithProgress(cmd, th.Duration, nil); err != nil {
 		return errors.Wrapf(err, "分片下载异常: %v", th.DlPath)
 	}
 
@@ -68,7 +68,7 @@ func initFromGlobalConfig() (err error) {
 		}
 	}()
 	tasks := config.G.Downloader.TaskThreadCount
-	downloads := config.G.Downloader.DlThreadCount
+	downloads := config.G.Downloader.DlPoolSize()
 	task, err = ants.NewPool(tasks, ants.WithOptions(commonAntsOptions()))
 	if err != nil {
 		err = errors.Wrap(err, "初始化下载任务协程池失败")
@@ -3,21 +3,26 @@
 package downloader
 
 import (
-	"fmt"
 	"log"
 	"math"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+	"video-downloader-go/internal/appctx"
+	"video-downloader-go/internal/archive"
 	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/downloader/coredl"
 	"video-downloader-go/internal/downloader/dlpool"
 	"video-downloader-go/internal/downloader/ytdl"
+	"video-downloader-go/internal/jobstore"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/postproc"
 	"video-downloader-go/internal/util/m3u8"
 	"video-downloader-go/internal/util/myfile"
 	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
 )
 
 // 错误信息
@@ -25,30 +30,24 @@ const (
 	UnValidM3U8 = "不是规范的 m3u8 地址"
 )
 
-// 任务下载完成处理函数
-type CompleteOne func()
+// 任务处理结束的处理函数, err 不为空时表示任务已经用完了尝试次数, 最终失败
+type CompleteOne func(dmt *meta.Download, err error)
 
 // 任务下载失败的监听器，下载器会将失败的任务传递出来
 type DlErrorHandler func(dmt *meta.Download)
 
-// CanDownloadChan 当下载器成功下载一个任务时, 就往该通道中写入信号, 通知解析器及时解析
-var CanDownloadChan = make(chan struct{}, 1)
-
 // ListenAndDownload 用于命令行模式下监听下载任务并依据全局配置多协程下载任务
 func ListenAndDownload(list *meta.TaskDeque[meta.Download], completeOne CompleteOne, dlErrorHandler DlErrorHandler) {
 	mylog.Info("开始监听下载列表...")
 	go func() {
 		for {
-			if list.Empty() {
-				// 没有下载任务，睡眠两秒
-				time.Sleep(time.Second * 2)
-				continue
+			// 阻塞等待下载任务, 程序终止或队列关闭时退出
+			dmt, err := list.Take(appctx.Context())
+			if err != nil {
+				return
 			}
-
-			// 取出一个下载任务来下载
-			dmt := list.PollFirst()
 			handleTask(dmt, completeOne, dlErrorHandler, func(d *meta.Download) {
-				list.OfferLast(dmt)
+				list.Offer(d, d.Priority)
 			})
 		}
 	}()
@@ -61,16 +60,48 @@ func handleTask(dmt *meta.Download, completeOne CompleteOne, dlErrorHandler DlEr
 
 		originFilename := dmt.FileName
 		link := dmt.Link
-		fileName := fmt.Sprintf("%s%s%s.mp4", config.G.Downloader.DownloadDir, string(filepath.Separator), originFilename)
+		container := config.G.Transfer.CustomContainer(dmt.OriginUrl)
+		fileName, err := outputPath(dmt, originFilename, container)
+		if err != nil {
+			// 重试也无法恢复, 直接结束任务, 避免程序一直等待
+			mylog.Errorf("生成输出文件名失败：%v", err)
+			dmt.LogBar.ErrorHint("生成文件名失败")
+			jobstore.G.Update(dmt.Id, func(t *meta.Task) {
+				t.State, t.Error = meta.TaskFailed, err.Error()
+			})
+			completeOne(dmt, err)
+			return
+		}
+		// 处理输出文件冲突, 下载结束前一直占用该路径
+		fileName, skip, err := reservePath(dmt, fileName)
+		if err != nil {
+			handleFailure(dmt, errors.Wrap(err, "处理输出文件冲突失败"), completeOne, dlErrorHandler, offerBack)
+			return
+		}
+		if skip {
+			mylog.Infof("文件已存在，跳过下载：%v", fileName)
+			// 下载报告按照 dmt.FileName 统计文件信息
+			dmt.FileName = fileName
+			archiveTask(dmt.OriginUrl, fileName)
+			jobstore.G.SetState(dmt.Id, meta.TaskDone)
+			completeOne(dmt, nil)
+			dmt.LogBar.OkHint("文件已存在, 跳过下载")
+			return
+		}
 		dmt.FileName = fileName
+		if dmt.StartAt.IsZero() {
+			dmt.StartAt = time.Now()
+		}
 		mylog.Infof("监听到下载任务，文件名：%v，下载地址：%v", fileName, link)
 		dmt.LogBar.UpdatePercentAndSize(0, 0)
+		dmt.ExpectedDuration, dmt.ExpectedStreams = 0, 0
+		jobstore.G.SetState(dmt.Id, meta.TaskDownloading)
 
 		// 初始化下载器并下载
 		cdl := initCoreDownloader(dmt)
 		progressMap := make(map[int]*coredl.Progress)
 		progressMu := sync.Mutex{}
-		err := cdl.Exec(dmt, func(p *coredl.Progress) {
+		err = cdl.Exec(dmt, func(p *coredl.Progress) {
 			progressMu.Lock()
 			defer progressMu.Unlock()
 			progressMap[p.CurrentTask] = p
@@ -93,53 +124,130 @@ func handleTask(dmt *meta.Download, completeOne CompleteOne, dlErrorHandler DlEr
 			dmt.LogBar.UpdatePercentAndSize(percent, size)
 		})
 
-		// 下载成功
+		// 下载完成后检查容器、校验文件, 失败时与下载失败的处理方式一致
 		if err == nil {
-			completeOne()
-			dmt.LogBar.OkHint("下载完成")
-			select {
-			case CanDownloadChan <- struct{}{}:
-			default:
+			jobstore.G.SetState(dmt.Id, meta.TaskMerging)
+			err = fitContainer(dmt)
+		}
+		if err == nil {
+			err = verifyOutput(dmt)
+		}
+		if err != nil {
+			// 下载出现异常，检查是否有下载一半的文件，将其删除
+			// 下载过程中可能会更换容器, 原始文件名和当前文件名都需要检查
+			myfile.DeleteAnyFileContainsPrefix(fileName)
+			if dmt.FileName != fileName {
+				myfile.DeleteAnyFileContainsPrefix(dmt.FileName)
 			}
+			// 字幕文件与视频文件同名但不以视频文件名为前缀, 需要单独清理
+			for _, sub := range dmt.Subtitles {
+				myfile.DeleteFileIfExist(sub)
+			}
+			dmt.Subtitles = nil
+			// 恢复原始的下载文件名, 清理完成后才释放路径, 避免误删其他任务的文件
+			dmt.FileName = originFilename
+			releasePath(fileName)
+
+			handleFailure(dmt, err, completeOne, dlErrorHandler, offerBack)
 			return
 		}
 
-		// 下载出现异常，检查是否有下载一半的文件，将其删除
-		myfile.DeleteAnyFileContainsPrefix(dmt.FileName)
-		// 恢复原始的下载文件名
-		dmt.FileName = originFilename
-
-		// 下载失败，无效的 m3u8
-		if strings.Contains(err.Error(), UnValidM3U8) {
-			mylog.Warnf("下载失败：%v, 重新添加到解析任务中，视频名称：%v", err, dmt.FileName)
-			dmt.LogBar.ErrorHint("下载失败, 等待重新解析")
-			// 触发下载异常
-			dlErrorHandler(dmt)
+		// 执行后处理, 失败时文件已经下载并校验完成, 重新下载无法解决问题, 保留文件并直接结束任务
+		// 后处理器可能已经移动了文件, 这里不能再按照前缀清理
+		if err = postproc.Run(dmt); err != nil {
+			mylog.Errorf("后处理失败：%v，已保留下载完成的文件：%v", err, dmt.FileName)
+			jobstore.G.Update(dmt.Id, func(t *meta.Task) {
+				t.State, t.Error = meta.TaskFailed, err.Error()
+			})
+			releasePath(fileName)
+			completeOne(dmt, err)
 			return
 		}
 
-		// 其他下载异常
-		mylog.Errorf("下载失败：%v，重新加入下载列表", err)
-		dmt.LogBar.ErrorHint("下载失败, 等待重新下载")
-		offerBack(dmt)
+		// 下载成功
+		archiveTask(dmt.OriginUrl, dmt.FileName)
+		jobstore.G.SetState(dmt.Id, meta.TaskDone)
+		releasePath(fileName)
+		completeOne(dmt, nil)
+		dmt.LogBar.OkHint("下载完成")
+	})
+}
+
+// handleFailure 处理一次失败的下载, 尝试次数用完时任务失败, 否则重新加入解析列表或下载列表
+func handleFailure(dmt *meta.Download, err error, completeOne CompleteOne, dlErrorHandler DlErrorHandler, offerBack func(*meta.Download)) {
+	dmt.Tries++
+	maxRetry := config.G.Downloader.CustomMaxRetry(dmt.OriginUrl)
+	if dmt.Tries >= maxRetry {
+		mylog.Errorf("下载失败：%v，已尝试 %d 次，视频名称：%v", err, dmt.Tries, dmt.FileName)
+		dmt.LogBar.ErrorHint("下载失败")
+		jobstore.G.Update(dmt.Id, func(t *meta.Task) {
+			t.State, t.Error, t.Tries = meta.TaskFailed, err.Error(), dmt.Tries
+		})
+		completeOne(dmt, err)
+		return
+	}
+
+	// 下载失败，无效的 m3u8
+	if strings.Contains(err.Error(), UnValidM3U8) {
+		mylog.Warnf("下载失败 (%d/%d)：%v, 重新添加到解析任务中，视频名称：%v", dmt.Tries, maxRetry, err, dmt.FileName)
+		dmt.LogBar.ErrorHint("下载失败, 等待重新解析")
+		jobstore.G.Update(dmt.Id, func(t *meta.Task) {
+			t.State, t.Error, t.Tries = meta.TaskQueued, err.Error(), dmt.Tries
+			t.ClearDownload()
+		})
+		// 触发下载异常
+		dlErrorHandler(dmt)
+		return
+	}
+
+	// 其他下载异常
+	mylog.Errorf("下载失败 (%d/%d)：%v，重新加入下载列表", dmt.Tries, maxRetry, err)
+	dmt.LogBar.ErrorHint("下载失败, 等待重新下载")
+	jobstore.G.Update(dmt.Id, func(t *meta.Task) {
+		t.State, t.Error, t.Tries = meta.TaskDecoded, err.Error(), dmt.Tries
 	})
+	offerBack(dmt)
+}
+
+// archiveTask 将下载成功的任务写入下载存档, 写入失败不影响任务本身
+//
+// 同时记录文件的时长, 文件之后被修改时仍然可以用于 skip-if-verified 的校验
+func archiveTask(originUrl, fileName string) {
+	if archive.G == nil {
+		return
+	}
+	var duration time.Duration
+	if pr, err := ffmpeg.Probe(fileName); err == nil {
+		duration = pr.Duration
+	}
+	if err := archive.G.Add(originUrl, fileName, duration); err != nil {
+		mylog.Warnf("写入下载存档失败：%v", err)
+	}
+}
+
+// isM3U8 判断任务的主下载地址是否为 m3u8 资源, 优先使用解析器提供的资源类型
+func isM3U8(dmt *meta.Download) bool {
+	if dmt.Resource != meta.ResourceUnknown {
+		return dmt.Resource == meta.ResourceM3U8
+	}
+	return m3u8.CheckM3U8WithClient(dmt.Link, dmt.HeaderMap, dmt.Client())
 }
 
 // initCoreDownloader 根据全局配置初始化下载器对象
 // 优先匹配定制化配置
 func initCoreDownloader(dmt *meta.Download) coredl.Downloader {
 
-	// 如果是通过 youtube-dl 解析的，就使用适配的下载器
-	if config.G.Decoder.CustomUse(dmt.OriginUrl) == config.DecoderYoutubeDl {
-		return ytdl.New()
-	}
-
 	// 获取配置
-	dlType := config.G.Downloader.Use
+	dlType := config.G.Downloader.CustomUse(dmt.OriginUrl)
+
+	// 如果解析器返回的是音视频分离的多个媒体流，就使用适配的 youtube-dl 下载器分别下载再合并
+	if dmt.MultiStream() {
+		return ytdl.New(dlType)
+	}
 
 	// 识别资源类型
 	resource := config.ResourceMP4
-	if m3u8.CheckM3U8(dmt.Link, dmt.HeaderMap) {
+	if isM3U8(dmt) {
 		resource = config.ResourceM3U8
 	}
 
@@ -1,15 +1,132 @@
 package downloader_test
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/downloader"
 	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/report"
 	"video-downloader-go/internal/util/mylog"
+	"video-downloader-go/internal/util/mylog/dlbar"
+	"video-downloader-go/internal/util/mytokenbucket"
 )
 
+// useLocalDownloader 使用单线程下载器下载到 dir 中, 测试结束后恢复全局配置
+func useLocalDownloader(t *testing.T, dir string) {
+	originDl, originTf, originPp := config.G.Downloader, config.G.Transfer, config.G.PostProcessors
+	originBucket := mytokenbucket.GlobalBucket
+	t.Cleanup(func() {
+		config.G.Downloader, config.G.Transfer, config.G.PostProcessors = originDl, originTf, originPp
+		mytokenbucket.GlobalBucket = originBucket
+	})
+	config.G.Downloader.Use = config.DownloadSimple
+	config.G.Downloader.DownloadDir = dir
+	config.G.Downloader.TaskThreadCount = 1
+	config.G.Downloader.DlThreadCount = 1
+	config.G.Downloader.MaxRetry = 3
+	config.G.Transfer.Container = "mp4"
+	mytokenbucket.GlobalBucket, _ = mytokenbucket.NewTokenBucket(1024 * 1024 * 1024)
+}
+
+// downloadOne 监听下载一个任务, 返回任务结束时的状态
+func downloadOne(t *testing.T, dmt *meta.Download) (*meta.Download, error) {
+	list := meta.TaskDeque[meta.Download]{}
+	dmt.LogBar = dlbar.NewBar()
+	list.OfferLast(dmt)
+	// 关闭队列使监听协程退出, 不终止应用上下文, 避免影响其他测试
+	defer list.Close()
+
+	type result struct {
+		dmt *meta.Download
+		err error
+	}
+	done := make(chan result, 1)
+	downloader.ListenAndDownload(&list, func(dmt *meta.Download, err error) {
+		done <- result{dmt, err}
+	}, func(dmt *meta.Download) {
+		t.Errorf("不应重新解析任务: %v", dmt.FileName)
+	})
+
+	select {
+	case res := <-done:
+		return res.dmt, res.err
+	case <-time.After(time.Minute):
+		t.Fatal("等待任务结束超时")
+		return nil, nil
+	}
+}
+
+// 测试后处理失败时保留已下载的文件, 不重新下载, 也不清理移动目标目录中的其他文件
+func TestPostProcessFailedAfterMove(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 false 命令")
+	}
+
+	content := []byte(strings.Repeat("video", 1024))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	moveDir := filepath.Join(dir, "moved")
+	if err := os.MkdirAll(moveDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// 移动目标目录中与输出文件同名前缀的用户文件
+	sibling := filepath.Join(moveDir, "测试.mp4.txt")
+	if err := os.WriteFile(sibling, []byte("user"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	useLocalDownloader(t, dir)
+	config.G.PostProcessors = []config.PostProcessor{
+		{Use: config.PostProcessMove, Target: filepath.Join(moveDir, "{filename}")},
+		{Use: config.PostProcessExec, Command: []string{"false"}},
+	}
+
+	if _, err := downloadOne(t, meta.NewDownloadMeta(srv.URL+"/a.mp4", "测试", "")); err == nil {
+		t.Fatal("后处理失败时任务应失败")
+	}
+	if got, err := os.ReadFile(filepath.Join(moveDir, "测试.mp4")); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("已下载的文件应被保留, err: %v", err)
+	}
+	if _, err := os.Stat(sibling); err != nil {
+		t.Fatalf("移动目标目录中的其他文件不应被删除: %v", err)
+	}
+}
+
+// 测试文件已存在而跳过下载时, 下载报告记录的是已存在的文件
+func TestSkipExistingReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "测试.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	useLocalDownloader(t, dir)
+	config.G.Downloader.ExistPolicy = config.ExistPolicySkip
+
+	dmt, err := downloadOne(t, meta.NewDownloadMeta("http://127.0.0.1:1/a.mp4", "测试", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := report.FromDownload(dmt, nil)
+	if e.Path != path || e.Size != int64(len("video")) {
+		t.Fatalf("下载报告异常, path: %s, size: %d", e.Path, e.Size)
+	}
+}
+
 // 测试下载监听器能否正常运行
 func TestUseListenerToDownload(t *testing.T) {
 	defer appctx.WaitGroup().Wait()
@@ -22,8 +139,12 @@ func TestUseListenerToDownload(t *testing.T) {
 
 	var wg sync.WaitGroup
 	wg.Add(1)
-	downloader.ListenAndDownload(&list, func() {
-		mylog.Success("成功下载完成一个任务")
+	downloader.ListenAndDownload(&list, func(dmt *meta.Download, err error) {
+		if err != nil {
+			mylog.Errorf("下载失败了, %v", err)
+		} else {
+			mylog.Success("成功下载完成一个任务")
+		}
 		wg.Done()
 	}, func(dmt *meta.Download) {
 		mylog.Errorf("下载失败了, %v", dmt)
@@ -0,0 +1,172 @@
+// 输出文件冲突处理
+
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"video-downloader-go/internal/archive"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/m3u8"
+	"video-downloader-go/internal/util/myfile"
+	"video-downloader-go/internal/util/myhttp"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
+)
+
+// reservedPaths 记录正在下载中的任务占用的输出路径, 避免两个任务同时写入同一个文件
+var reservedPaths = struct {
+	sync.Mutex
+	m map[string]struct{}
+}{m: make(map[string]struct{})}
+
+// reservePath 按照配置的策略处理输出路径冲突, 并占用最终的输出路径
+//
+// 路径被其他正在下载的任务占用时, 无论策略如何都会重命名;
+// 文件已存在于磁盘上时, 按照 exist-policy 处理
+// 检查和处理已存在的文件之前先占用路径, 同一路径的其他任务只能重命名, 不会同时删除或覆盖这个文件
+// @return 最终的输出路径, 是否跳过下载, 跳过下载时不会占用路径
+func reservePath(dmt *meta.Download, path string) (string, bool, error) {
+	reservedPaths.Lock()
+	if _, reserved := reservedPaths.m[path]; reserved {
+		defer reservedPaths.Unlock()
+		renamed := nextFreePath(path)
+		mylog.Warnf("输出路径已被占用，重命名为：%s", renamed)
+		reservedPaths.m[renamed] = struct{}{}
+		return renamed, false, nil
+	}
+	reservedPaths.m[path] = struct{}{}
+	reservedPaths.Unlock()
+
+	skip, rename, err := applyExistPolicy(dmt, path)
+	if err != nil || skip {
+		releasePath(path)
+		return path, skip, err
+	}
+	if rename {
+		reservedPaths.Lock()
+		defer reservedPaths.Unlock()
+		renamed := nextFreePath(path)
+		mylog.Warnf("输出文件已存在，重命名为：%s", renamed)
+		delete(reservedPaths.m, path)
+		reservedPaths.m[renamed] = struct{}{}
+		path = renamed
+	}
+	return path, false, nil
+}
+
+// applyExistPolicy 输出文件已存在于磁盘上时按照 exist-policy 处理, 调用方需要已经占用了该路径
+// @return 是否跳过下载, 是否需要重命名
+func applyExistPolicy(dmt *meta.Download, path string) (bool, bool, error) {
+	if !myfile.FileExist(path) {
+		return false, false, nil
+	}
+	switch config.G.Downloader.CustomExistPolicy(dmt.OriginUrl) {
+	case config.ExistPolicySkip:
+		return true, false, nil
+	case config.ExistPolicySkipIfVerified:
+		if existingVerified(dmt, path) {
+			return true, false, nil
+		}
+		mylog.Warnf("已存在的文件校验不通过，重新下载：%s", path)
+		if err := os.Remove(path); err != nil {
+			return false, false, errors.Wrapf(err, "删除已存在的文件失败：%s", path)
+		}
+	case config.ExistPolicyOverwrite:
+		// 先删除旧文件, 避免新旧内容交错, 也避免 ffmpeg 因目标文件已存在而中止
+		if err := os.Remove(path); err != nil {
+			return false, false, errors.Wrapf(err, "删除已存在的文件失败：%s", path)
+		}
+	case config.ExistPolicyRename:
+		return false, true, nil
+	}
+	return false, false, nil
+}
+
+// isReserved 判断输出路径是否被正在下载的任务占用
+func isReserved(path string) bool {
+	reservedPaths.Lock()
+	defer reservedPaths.Unlock()
+	_, ok := reservedPaths.m[path]
+	return ok
+}
+
+// releasePath 释放任务占用的输出路径
+func releasePath(path string) {
+	reservedPaths.Lock()
+	defer reservedPaths.Unlock()
+	delete(reservedPaths.m, path)
+}
+
+// nextFreePath 在文件名后追加序号, 返回一个既不存在于磁盘上也没有被占用的路径
+//
+// 调用方需要持有 reservedPaths 的锁
+func nextFreePath(path string) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, ok := reservedPaths.m[candidate]; ok {
+			continue
+		}
+		if !myfile.FileExist(candidate) {
+			return candidate
+		}
+	}
+}
+
+// existingVerified 检查已存在的文件是否就是下载源的完整副本
+//
+// 下载存档中记录了这个文件时, 与记录的大小或时长比较, 因为转换容器和后处理会改变文件大小;
+// 否则 m3u8 资源比较时长, 其他资源比较文件大小, 多个媒体流合并的资源只检查文件能否正常解析
+func existingVerified(dmt *meta.Download, path string) bool {
+	pr, err := ffmpeg.Probe(path)
+	if err != nil || pr.Duration <= 0 {
+		return false
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if archive.G != nil {
+		if r, ok := archive.G.Get(dmt.OriginUrl); ok && filepath.Clean(r.Path) == filepath.Clean(path) {
+			if r.Size == stat.Size() {
+				return true
+			}
+			if r.Duration > 0 {
+				return checkProbeResult(pr, r.Duration, 0) == nil
+			}
+		}
+	}
+
+	if dmt.MultiStream() {
+		return true
+	}
+
+	if isM3U8(dmt) {
+		tsMetas, err := m3u8.ReadTsUrlsWithClient(dmt.Link, dmt.HeadersOf(dmt.Link), dmt.Client())
+		if err != nil {
+			return false
+		}
+		var total time.Duration
+		for _, tmt := range tsMetas {
+			total += tmt.Duration
+		}
+		return checkProbeResult(pr, total, 0) == nil
+	}
+
+	ranges, err := myhttp.GetRequestRangesFrom(dmt.Link, http.MethodGet, dmt.HeadersOf(dmt.Link), 0, dmt.Client())
+	if err != nil {
+		return false
+	}
+	return stat.Size() == ranges[1]
+}
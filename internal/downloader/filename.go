@@ -0,0 +1,65 @@
+// 输出文件名生成
+
+package downloader
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/myfile"
+
+	"github.com/pkg/errors"
+)
+
+// FilenameMaxBytes 每一层文件名的最大字节数
+//
+// 大多数文件系统限制为 255 字节, 这里预留出分片目录、子任务等临时文件追加的后缀
+const FilenameMaxBytes = 200
+
+// outputPath 根据文件名模板生成任务的输出路径, 并自动创建子目录
+// @param name      任务名称, 即 data.txt 中配置的文件名
+// @param container 输出容器
+func outputPath(dmt *meta.Download, name, container string) (string, error) {
+	path, err := renderOutputPath(dmt.Vars, name, dmt.OriginUrl, container)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", errors.Wrapf(err, "创建输出目录失败: %s", path)
+	}
+	return path, nil
+}
+
+// PredictOutputPath 在解析之前预测任务的输出路径, 用于提前发现输出路径重复的任务
+//
+// 此时还拿不到解析器提供的变量, 预测结果只包含任务本身的信息
+func PredictOutputPath(name, originUrl string) (string, error) {
+	return renderOutputPath(nil, name, originUrl, config.G.Transfer.CustomContainer(originUrl))
+}
+
+// renderOutputPath 使用任务变量渲染文件名模板, 生成输出路径
+func renderOutputPath(taskVars map[string]string, name, originUrl, container string) (string, error) {
+	vars := map[string]string{}
+	for k, v := range taskVars {
+		vars[k] = v
+	}
+	host := ""
+	if u, err := url.Parse(originUrl); err == nil {
+		host = u.Host
+	}
+	vars["name"], vars["ext"], vars["host"] = name, container, host
+	vars["date"] = time.Now().Format("2006-01-02")
+
+	rel := myfile.RenderFilename(config.G.Downloader.CustomFilenameTemplate(originUrl), vars, FilenameMaxBytes)
+	if rel == "" {
+		// 模板渲染结果为空时, 退回到默认模板
+		rel = myfile.RenderFilename(config.DefaultFilenameTemplate, vars, FilenameMaxBytes)
+	}
+	if rel == "" {
+		return "", errors.Errorf("无法根据任务名称生成文件名: %s", name)
+	}
+	return filepath.Join(config.G.Downloader.CustomDownloadDir(originUrl), rel), nil
+}
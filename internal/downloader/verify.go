@@ -0,0 +1,58 @@
+// 下载完成后的文件校验
+
+package downloader
+
+import (
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/meta"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	VerifyMinTolerance     = 2 * time.Second // 时长校验的最小容差
+	VerifyTolerancePercent = 2               // 时长校验的容差百分比
+)
+
+// verifyOutput 探测下载完成的文件, 检查是否能正常解析,
+// 并与下载器得知的预期时长、预期媒体流个数进行比对, 用于发现被截断或损坏的文件
+func verifyOutput(dmt *meta.Download) error {
+	if config.G.Downloader.CustomVerify(dmt.OriginUrl) != config.DownloadVerifyActive {
+		return nil
+	}
+	dmt.LogBar.TransferHint("正在校验文件")
+
+	pr, err := ffmpeg.Probe(dmt.FileName)
+	if err != nil {
+		return errors.Wrapf(err, "文件校验失败: %s", dmt.FileName)
+	}
+	return checkProbeResult(pr, dmt.ExpectedDuration, dmt.ExpectedStreams)
+}
+
+// checkProbeResult 将探测结果与预期结果进行比对, 预期值为 0 时不比对该项
+func checkProbeResult(pr *ffmpeg.ProbeResult, expectedDuration time.Duration, expectedStreams int) error {
+	if pr.Duration <= 0 {
+		return errors.New("文件校验失败: 无法读取视频时长")
+	}
+
+	if expectedStreams > 0 && len(pr.Streams) < expectedStreams {
+		return errors.Errorf("文件校验失败: 媒体流个数不符, 预期: %d, 实际: %d", expectedStreams, len(pr.Streams))
+	}
+
+	if expectedDuration > 0 {
+		tolerance := expectedDuration * VerifyTolerancePercent / 100
+		if tolerance < VerifyMinTolerance {
+			tolerance = VerifyMinTolerance
+		}
+		diff := pr.Duration - expectedDuration
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			return errors.Errorf("文件校验失败: 视频时长不符, 预期: %v, 实际: %v", expectedDuration, pr.Duration)
+		}
+	}
+	return nil
+}
@@ -2,12 +2,17 @@ package ytdl
 
 import (
 	"fmt"
+	"net/url"
 	"os"
-	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/downloader/coredl"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/transfer"
 	"video-downloader-go/internal/util/m3u8"
 	"video-downloader-go/internal/util/myfile"
 	"video-downloader-go/internal/util/mylog"
@@ -23,9 +28,10 @@ type YtDlDownloader struct {
 }
 
 // New 初始化一个 youtube-dl 下载器
-func New() coredl.Downloader {
+// @param dlType 下载器类型, 决定每个媒体流使用单协程还是多协程下载
+func New(dlType string) coredl.Downloader {
 	dl := new(YtDlDownloader)
-	if config.G.Downloader.Use == config.DownloadMultiThread {
+	if dlType == config.DownloadMultiThread {
 		dl.m3u8Dl = coredl.NewM3U8MultiThread()
 		dl.mp4Dl = coredl.NewMp4MultiThread()
 		return dl
@@ -36,10 +42,12 @@ func New() coredl.Downloader {
 }
 
 // Exec 是实现 coredl.Downloader 的核心下载逻辑
+//
+// 依次下载每个媒体流, 音视频流合并为输出文件, 字幕流保存在输出文件的同一目录下并记录在 dmt.Subtitles 中
 func (d *YtDlDownloader) Exec(dmt *meta.Download, handlerFunc coredl.ProgressHandler) error {
 	// 1 恢复下载信息
-	links := meta.Split2YtDlLinks(dmt.Link)
-	size := len(links)
+	streams := dmt.Streams
+	size := len(streams)
 
 	// 2 拆分任务
 	progressHandler := func(curTask int) coredl.ProgressHandler {
@@ -49,13 +57,32 @@ func (d *YtDlDownloader) Exec(dmt *meta.Download, handlerFunc coredl.ProgressHan
 		}
 	}
 
-	for i, link := range links {
+	var expectedDuration time.Duration
+	partNames := make([]string, 0, size)
+	dmt.Subtitles = nil
+	for i, stream := range streams {
 		mylog.Infof("正在处理第 %d / %d 个子任务，文件名：%s", i+1, size, dmt.FileName)
-		tmpDmt := meta.NewDownloadMeta(link, strings.Replace(dmt.FileName, ".mp4", d.getFilePartSuffix(i), -1), dmt.OriginUrl)
-		tmpDmt.LogBar = dmt.LogBar
 
 		var err error
-		if m3u8.CheckM3U8(link, dmt.HeaderMap) {
+		// 资源类型提示只对音视频流生效, 字幕文件总是直接下载
+		resource, isM3U8 := meta.ResourceUnknown, false
+		if stream.Media() {
+			resource = dmt.Resource
+			isM3U8 = resource == meta.ResourceM3U8 ||
+				(resource == meta.ResourceUnknown && m3u8.CheckM3U8WithClient(stream.Url, stream.HeaderMap, dmt.Client()))
+		}
+		partName := d.getFilePartName(dmt.FileName, i, isM3U8)
+		if !stream.Media() {
+			// 下载之前就记录字幕文件, 下载失败时同样需要清理
+			partName = d.getSubtitleName(dmt.FileName, stream.Url, len(dmt.Subtitles))
+			dmt.Subtitles = append(dmt.Subtitles, partName)
+		}
+		tmpDmt := (&meta.DecodeResult{Streams: []meta.Stream{stream}, Resource: resource}).Download(partName, dmt.OriginUrl)
+		tmpDmt.LogBar = dmt.LogBar
+		tmpDmt.SetHeaders(dmt.Headers)
+		// 子任务共用同一个 cookie jar, 前面的媒体流响应中的 cookie 对后面的媒体流同样生效
+		tmpDmt.Jar = dmt.Jar
+		if isM3U8 {
 			err = d.m3u8Dl.Exec(tmpDmt, progressHandler(i+1))
 		} else {
 			err = d.mp4Dl.Exec(tmpDmt, progressHandler(i+1))
@@ -64,11 +91,23 @@ func (d *YtDlDownloader) Exec(dmt *meta.Download, handlerFunc coredl.ProgressHan
 		if err != nil {
 			return err
 		}
-
 		mylog.Successf("第 %d / %d 个子任务处理完成，文件名：%s", i+1, size, dmt.FileName)
+		if !stream.Media() {
+			continue
+		}
+		if tmpDmt.ExpectedDuration > expectedDuration {
+			expectedDuration = tmpDmt.ExpectedDuration
+		}
+		// 合并 m3u8 时可能会更换容器, 以子任务最终的文件名为准
+		partNames = append(partNames, tmpDmt.FileName)
+	}
+	if len(partNames) == 0 {
+		return errors.New("解析结果中没有可以合并的音视频流")
 	}
 
-	if err := d.mergeSubTask(dmt, size); err != nil {
+	// 每个子任务至少提供一个媒体流, 如视频流 + 音频流
+	dmt.ExpectedDuration, dmt.ExpectedStreams = expectedDuration, len(partNames)
+	if err := d.mergeSubTask(dmt, partNames); err != nil {
 		return errors.Wrap(err, "合并子任务失败")
 	}
 
@@ -76,17 +115,17 @@ func (d *YtDlDownloader) Exec(dmt *meta.Download, handlerFunc coredl.ProgressHan
 }
 
 // mergeSubTask 调用 ffmpeg 将子任务合并在一起
-func (d *YtDlDownloader) mergeSubTask(dmt *meta.Download, size int) error {
-	if size == 1 {
-		return d.mergeSingleSubTask(dmt)
+func (d *YtDlDownloader) mergeSubTask(dmt *meta.Download, partNames []string) error {
+	if len(partNames) == 1 {
+		return d.mergeSingleSubTask(dmt, partNames[0])
 	}
-	return d.mergeMultiSubTask(dmt, size)
+	return d.mergeMultiSubTask(dmt, partNames)
 }
 
 // mergeSingleSubTask 合并单个子任务
-func (d *YtDlDownloader) mergeSingleSubTask(dmt *meta.Download) error {
-	partName := strings.Replace(dmt.FileName, ".mp4", d.getFilePartSuffix(0), -1)
-
+//
+// 直接重命名文件, 文件实际的封装格式与后缀不符时由下载器统一处理
+func (d *YtDlDownloader) mergeSingleSubTask(dmt *meta.Download, partName string) error {
 	// 判断文件是否存在
 	stat, err := os.Stat(partName)
 	if err != nil || stat.IsDir() {
@@ -102,34 +141,48 @@ func (d *YtDlDownloader) mergeSingleSubTask(dmt *meta.Download) error {
 }
 
 // mergeMultiSubTask 合并多个子任务
-func (d *YtDlDownloader) mergeMultiSubTask(dmt *meta.Download, size int) error {
-	mylog.Infof("正在合并子任务，文件名：%s", dmt.FileName)
-
-	// 输入需要合并的子任务
+func (d *YtDlDownloader) mergeMultiSubTask(dmt *meta.Download, partNames []string) error {
+	// 输入需要合并的子任务, 并收集所有子任务的媒体流, 用于选择能够容纳它们的容器
 	commands := []string{}
-	for i := 0; i < size; i++ {
-		commands = append(commands, "-i", strings.Replace(dmt.FileName, ".mp4", d.getFilePartSuffix(i), -1))
+	streams := []ffmpeg.Stream{}
+	var duration time.Duration
+	for i, partName := range partNames {
+		commands = append(commands, "-i", partName)
+		pr, err := ffmpeg.Probe(partName)
+		if err != nil {
+			mylog.Warnf("读取子任务信息失败: %v", err)
+			continue
+		}
+		streams = append(streams, pr.Streams...)
+		// 以第一个子任务的时长作为预期总时长, 读取失败时只展示已处理时长
+		if i == 0 {
+			duration = pr.Duration
+		}
 	}
+	if dmt.ExpectedDuration <= 0 {
+		dmt.ExpectedDuration = duration
+	}
+
+	want := transfer.ContainerOf(dmt.FileName)
+	if fit := transfer.FitContainer(want, streams); fit != want {
+		mylog.Warnf("子任务的编码无法直接放入 %s 容器, 自动更换为 %s, 文件名：%s", want, fit, dmt.FileName)
+		dmt.FileName = transfer.ReplaceContainer(dmt.FileName, fit)
+	}
+	mylog.Infof("正在合并子任务，文件名：%s", dmt.FileName)
 
 	// 直接拷贝视频流和音频流，不进行转码
 	commands = append(commands, "-c:v", "copy", "-c:a", "copy", dmt.FileName)
 
 	// 执行命令
-	cmd := exec.Command(config.FfmpegPath, commands...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return errors.Wrap(err, "合并命令执行失败")
-	}
-
-	invalidInput := "Invalid data found when processing input"
-	if strings.Contains(string(output), invalidInput) {
+	cmd := ffmpeg.Command(commands...)
+	if err := ffmpeg.RunWithProgress(cmd, duration, transfer.ProgressHint(dmt.LogBar, "正在合并音视频")); err != nil {
 		mylog.Errorf("合并子任务失败，子任务不自动删除，文件名：%s", dmt.FileName)
+		return errors.Wrap(err, "合并命令执行失败")
 	}
 
 	mylog.Successf("子任务合并完成，正在删除子任务，文件名：%s", dmt.FileName)
 	flag := true
-	for i := 0; i < size; i++ {
-		partName := strings.Replace(dmt.FileName, ".mp4", d.getFilePartSuffix(i), 1)
+	for _, partName := range partNames {
 		if e, d := myfile.DeleteFileIfExist(partName); e && !d {
 			mylog.Warnf("子任务删除失败，文件名：%s", partName)
 			flag = false
@@ -141,7 +194,27 @@ func (d *YtDlDownloader) mergeMultiSubTask(dmt *meta.Download, size int) error {
 	return nil
 }
 
-// getFilePartSuffix 根据子任务索引返回子任务的文件后缀
-func (d *YtDlDownloader) getFilePartSuffix(i int) string {
-	return fmt.Sprintf("_part%d.mp4", i)
+// getFilePartName 根据子任务索引返回子任务的文件名
+//
+// m3u8 子任务需要合并分片, 以 .ts 结尾便于 ffmpeg 识别输出格式, 其他子任务直接保存原始数据
+func (d *YtDlDownloader) getFilePartName(fileName string, i int, isM3U8 bool) string {
+	if isM3U8 {
+		return fmt.Sprintf("%s.part%d.%s", fileName, i, config.ContainerTS)
+	}
+	return fmt.Sprintf("%s.part%d", fileName, i)
+}
+
+// getSubtitleName 根据字幕流的下载地址返回字幕文件名, 与输出文件同名, 后缀取下载地址中的后缀
+//
+// 有多个字幕流时, 从第二个开始在文件名中追加序号
+func (d *YtDlDownloader) getSubtitleName(fileName, link string, i int) string {
+	ext := ".srt"
+	if u, err := url.Parse(link); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if i > 0 {
+		base = fmt.Sprintf("%s.%d", base, i)
+	}
+	return base + ext
 }
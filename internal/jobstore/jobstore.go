@@ -0,0 +1,216 @@
+// 任务持久化存储, 记录每个任务的处理状态, 程序重启后从记录的状态继续处理
+package jobstore
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"video-downloader-go/internal/archive"
+	"video-downloader-go/internal/constant"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPath 任务存储文件的默认存放路径
+var DefaultPath = filepath.Join(constant.Dir_DataRoot, "jobs.jsonl")
+
+// G 全局的任务存储, 为 nil 时不持久化任何状态
+var G *Store
+
+// Store 任务存储, 以 JSON Lines 的格式追加写入任务的最新状态
+//
+// 同一个任务存在多条记录时, 以最后一条为准, 每次打开时会压缩文件并丢弃已经终止的任务
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	tasks map[string]*meta.Task
+	order []string // 任务 id 的加入顺序
+}
+
+// TaskId 根据任务名称和源视频地址生成稳定的任务 id, 同一行任务在多次运行中保持一致
+func TaskId(name, originUrl string) string {
+	sum := sha1.Sum([]byte(name + "|" + archive.Normalize(originUrl)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Open 读取任务存储, 文件不存在时返回空的存储
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, tasks: make(map[string]*meta.Task)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "打开任务存储失败：%s", path)
+	}
+
+	scanner := bufio.NewScanner(f)
+	// 单行记录中包含请求头和多个下载地址, 可能超出默认的缓冲区大小
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		t := new(meta.Task)
+		if err = json.Unmarshal([]byte(line), t); err != nil {
+			// 进程中断时最后一行可能只写入了一半, 忽略即可
+			mylog.Warnf("忽略任务存储中无法解析的记录, 第 %d 行：%v", lineNo, err)
+			continue
+		}
+		if _, ok := s.tasks[t.Id]; !ok {
+			s.order = append(s.order, t.Id)
+		}
+		s.tasks[t.Id] = t
+	}
+	err = scanner.Err()
+	f.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "读取任务存储失败：%s", path)
+	}
+
+	// 已完成的任务记录在下载存档中, 失败的任务在 data.txt 中时会重新加入, 都不需要继续保留
+	order := []string{}
+	for _, id := range s.order {
+		if s.tasks[id].Finished() {
+			delete(s.tasks, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	s.order = order
+	if err = s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get 获取任务记录的副本
+func (s *Store) Get(id string) (meta.Task, bool) {
+	if s == nil {
+		return meta.Task{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return meta.Task{}, false
+	}
+	return *t, true
+}
+
+// List 按照加入顺序返回所有任务记录的副本
+func (s *Store) List() []meta.Task {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ans := make([]meta.Task, 0, len(s.order))
+	for _, id := range s.order {
+		ans = append(ans, *s.tasks[id])
+	}
+	return ans
+}
+
+// Put 写入一个任务的最新状态
+func (s *Store) Put(t meta.Task) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(&t)
+}
+
+// Update 修改一个任务的状态并写入, 任务不存在时忽略
+//
+// 写入失败只输出警告, 不影响任务本身的处理
+func (s *Store) Update(id string, fn func(t *meta.Task)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.tasks[id]
+	if !ok {
+		return
+	}
+	t := *old
+	fn(&t)
+	if err := s.put(&t); err != nil {
+		mylog.Warnf("写入任务状态失败：%v", err)
+	}
+}
+
+// SetState 修改任务状态, 是 Update 的简便写法
+func (s *Store) SetState(id string, state meta.TaskState) {
+	s.Update(id, func(t *meta.Task) { t.State = state })
+}
+
+// put 追加写入一条记录, 调用方需要持有锁
+func (s *Store) put(t *meta.Task) error {
+	t.UpdatedAt = time.Now()
+	line, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "序列化任务记录失败")
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "创建任务存储目录失败：%s", s.path)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "打开任务存储失败：%s", s.path)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "写入任务存储失败：%s", s.path)
+	}
+
+	if _, ok := s.tasks[t.Id]; !ok {
+		s.order = append(s.order, t.Id)
+	}
+	s.tasks[t.Id] = t
+	return nil
+}
+
+// compact 将每个任务的最新状态重写到文件中, 先写入临时文件再替换
+func (s *Store) compact() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "创建任务存储目录失败：%s", s.path)
+	}
+	tmpPath := s.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrapf(err, "创建临时文件失败：%s", tmpPath)
+	}
+	w := bufio.NewWriter(f)
+	for _, id := range s.order {
+		var line []byte
+		if line, err = json.Marshal(s.tasks[id]); err != nil {
+			break
+		}
+		if _, err = w.Write(append(line, '\n')); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "压缩任务存储失败：%s", s.path)
+	}
+	return errors.Wrapf(os.Rename(tmpPath, s.path), "替换任务存储失败：%s", s.path)
+}
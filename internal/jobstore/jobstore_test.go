@@ -0,0 +1,89 @@
+package jobstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"video-downloader-go/internal/jobstore"
+	"video-downloader-go/internal/meta"
+)
+
+func TestTaskId(t *testing.T) {
+	id1 := jobstore.TaskId("第一集", "https://Example.com/1#t=3")
+	id2 := jobstore.TaskId("第一集", "https://example.com/1")
+	if id1 != id2 {
+		t.Fatalf("同一个任务的 id 应该一致: %s, %s", id1, id2)
+	}
+	if id1 == jobstore.TaskId("第二集", "https://example.com/1") {
+		t.Fatal("不同名称的任务 id 不应该一致")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	s, err := jobstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err = s.Put(meta.Task{Id: id, Name: id, Url: "https://example.com/" + id, State: meta.TaskQueued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Update("a", func(task *meta.Task) {
+		task.State = meta.TaskDecoded
+		task.Streams = []meta.Stream{
+			{Url: "https://cdn.example.com/v.m3u8", Role: meta.StreamVideo, HeaderMap: map[string]string{"Cookie": "a=1"}},
+			{Url: "https://cdn.example.com/a.m3u8", Role: meta.StreamAudio},
+		}
+		task.ExpireAt = time.Now().Add(time.Hour)
+	})
+	s.SetState("b", meta.TaskDone)
+	s.Update("c", func(task *meta.Task) { task.State, task.Error = meta.TaskFailed, "解析失败" })
+	s.SetState("not-exist", meta.TaskDone)
+
+	// 模拟进程中断时写入了一半的记录
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"id":"a","state":"dow`)
+	f.Close()
+
+	s, err = jobstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := s.List()
+	if len(list) != 1 || list[0].Id != "a" {
+		t.Fatalf("重新打开后应该只保留未终止的任务: %+v", list)
+	}
+	task, _ := s.Get("a")
+	if !task.Decoded() {
+		t.Fatalf("解析结果未过期的任务应该可以直接下载: %+v", task)
+	}
+	dmt := task.Download(nil)
+	if dmt.Id != "a" || dmt.Link != task.Streams[0].Url || dmt.FileName != "a" || !dmt.MultiStream() {
+		t.Fatalf("转换下载任务异常: %v", dmt)
+	}
+	if dmt.HeaderMap["Cookie"] != "a=1" || dmt.Streams[1].Role != meta.StreamAudio {
+		t.Fatalf("媒体流的请求头和作用没有保留: %+v", dmt.Streams)
+	}
+
+	s.Update("a", func(task *meta.Task) { task.ExpireAt = time.Now().Add(-time.Minute) })
+	if task, _ = s.Get("a"); task.Decoded() {
+		t.Fatal("解析结果过期的任务需要重新解析")
+	}
+}
+
+func TestLinkExpireAt(t *testing.T) {
+	expire := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	got := meta.LinkExpireAt("https://cdn.example.com/a.mp4?e=1&expires=" + strconv.FormatInt(expire.Unix(), 10))
+	if !got.Equal(expire) {
+		t.Fatalf("识别过期时间异常: %v, 期望: %v", got, expire)
+	}
+	got = meta.LinkExpireAt("https://cdn.example.com/a.mp4")
+	if d := time.Until(got); d < meta.DefaultLinkTTL-time.Minute || d > meta.DefaultLinkTTL {
+		t.Fatalf("默认过期时间异常: %v", d)
+	}
+}
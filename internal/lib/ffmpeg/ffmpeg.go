@@ -0,0 +1,228 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StderrTailSize 执行失败时, 错误信息中最多保留的 stderr 字节数
+	StderrTailSize = 4096
+)
+
+// ProgressHandler 接收 ffmpeg 的实时处理进度
+//
+// 当预期总时长未知时, percent 为 -1, eta 为 -1, processed 为已处理的媒体时长
+type ProgressHandler func(percent int, eta time.Duration, processed time.Duration)
+
+// durationRegex 用于从 ffmpeg 的输出中匹配出媒体时长
+var durationRegex = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// formatRegex 用于从 ffmpeg 的输出中匹配出输入文件的封装格式
+var formatRegex = regexp.MustCompile(`Input #0, ([^ ]+), from`)
+
+// streamRegex 用于从 ffmpeg 的输出中匹配出媒体流的类型和编码
+var streamRegex = regexp.MustCompile(`Stream #\d+:\d+[^:]*: (Video|Audio|Subtitle|Data): (\w+)`)
+
+// 媒体流类型
+const (
+	StreamVideo    = "Video"
+	StreamAudio    = "Audio"
+	StreamSubtitle = "Subtitle"
+	StreamData     = "Data"
+)
+
+// Stream 媒体文件中的一个流
+type Stream struct {
+	Type  string // 流类型, Video, Audio, Subtitle, Data
+	Codec string // 编码, 如 h264, aac
+}
+
+// ProbeResult 媒体文件的探测结果
+type ProbeResult struct {
+	Format   string        // 封装格式, 如 mpegts, matroska,webm
+	Duration time.Duration // 媒体时长, 未知时为 0
+	Streams  []Stream      // 媒体流列表
+}
+
+// Count 统计指定类型的流个数
+func (pr *ProbeResult) Count(streamType string) int {
+	cnt := 0
+	for _, s := range pr.Streams {
+		if s.Type == streamType {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// ProgressArgs 返回让 ffmpeg 将处理进度输出到标准输出的参数
+func ProgressArgs() []string {
+	return []string{"-progress", "pipe:1", "-nostats"}
+}
+
+// Command 构造一个携带进度输出参数的 ffmpeg 命令
+func Command(args ...string) *exec.Cmd {
+	return exec.Command(execPath, append(ProgressArgs(), args...)...)
+}
+
+// RunWithProgress 执行一个已经携带了 -progress pipe:1 参数的命令,
+// 逐行解析标准输出中的进度信息, 并根据预期总时长 total 计算百分比和剩余时间
+//
+// 命令的 stderr 会被捕获, 执行失败时附带在返回的错误信息中
+func RunWithProgress(cmd *exec.Cmd, total time.Duration, handler ProgressHandler) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("获取 ffmpeg 标准输出失败: %v", err)
+	}
+	stderr := newTailBuffer(StderrTailSize)
+	cmd.Stderr = stderr
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("启动 ffmpeg 失败: %v", err)
+	}
+
+	start := time.Now()
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || handler == nil {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// 两个字段的单位都是微秒, 旧版本的 ffmpeg 只输出 out_time_ms
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || us < 0 {
+				continue
+			}
+			processed := time.Duration(us) * time.Microsecond
+			percent, eta := CalcProgress(processed, total, time.Since(start))
+			handler(percent, eta, processed)
+		case "progress":
+			if value == "end" && total > 0 {
+				handler(100, 0, total)
+			}
+		}
+	}
+	// 确保管道中的数据全部被读取, 避免 Wait 阻塞
+	io.Copy(io.Discard, stdout)
+
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("执行 ffmpeg 失败: %v, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// CalcProgress 根据已处理时长、预期总时长以及已消耗的时间计算百分比和剩余时间
+//
+// total 未知时返回 (-1, -1), 在收到结束信号之前, 百分比最多为 99
+func CalcProgress(processed, total, elapsed time.Duration) (int, time.Duration) {
+	if total <= 0 {
+		return -1, -1
+	}
+	if processed > total {
+		processed = total
+	}
+
+	percent := int(processed * 100 / total)
+	if percent > 99 {
+		percent = 99
+	}
+
+	if processed <= 0 {
+		return percent, -1
+	}
+	eta := time.Duration(float64(elapsed) * float64(total-processed) / float64(processed))
+	return percent, eta.Round(time.Second)
+}
+
+// Probe 调用 ffmpeg 读取媒体文件的时长和流信息
+//
+// 这里没有使用 ffprobe, 是因为自动下载的只有 ffmpeg, 二者对输入文件输出的信息是一致的
+func Probe(path string) (*ProbeResult, error) {
+	// 没有指定输出文件时 ffmpeg 会以非 0 状态码退出, 这里只关心输出内容
+	output, _ := exec.Command(execPath, "-hide_banner", "-i", path).CombinedOutput()
+	return ParseProbe(string(output))
+}
+
+// ParseProbe 从 ffmpeg 对输入文件的输出信息中解析出媒体时长和流信息
+func ParseProbe(output string) (*ProbeResult, error) {
+	for _, broken := range []string{"Invalid data found when processing input", "moov atom not found", "No such file or directory"} {
+		if strings.Contains(output, broken) {
+			return nil, fmt.Errorf("媒体文件无法解析: %s", broken)
+		}
+	}
+
+	pr := new(ProbeResult)
+	pr.Duration, _ = ParseDuration(output)
+	if m := formatRegex.FindStringSubmatch(output); len(m) > 1 {
+		pr.Format = strings.TrimSuffix(m[1], ",")
+	}
+	for _, m := range streamRegex.FindAllStringSubmatch(output, -1) {
+		pr.Streams = append(pr.Streams, Stream{Type: m[1], Codec: m[2]})
+	}
+	if len(pr.Streams) == 0 {
+		return nil, errors.New("媒体文件中没有可用的流")
+	}
+	return pr, nil
+}
+
+// ProbeDuration 调用 ffmpeg 读取媒体文件的时长
+func ProbeDuration(path string) (time.Duration, error) {
+	pr, err := Probe(path)
+	if err != nil || pr.Duration <= 0 {
+		return 0, fmt.Errorf("无法读取媒体时长: %s", path)
+	}
+	return pr.Duration, nil
+}
+
+// ParseDuration 从 ffmpeg 的输出信息中解析出媒体时长
+func ParseDuration(output string) (time.Duration, bool) {
+	m := durationRegex.FindStringSubmatch(output)
+	if len(m) < 4 {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	d := time.Duration(h)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec*float64(time.Second))
+	return d, d > 0
+}
+
+// tailBuffer 只保留最后写入的 size 个字节, 用于捕获 stderr
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  bytes.Buffer
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.buf.Write(p)
+	if overflow := tb.buf.Len() - tb.size; overflow > 0 {
+		tb.buf.Next(overflow)
+	}
+	return len(p), nil
+}
+
+func (tb *tailBuffer) String() string {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.buf.String()
+}
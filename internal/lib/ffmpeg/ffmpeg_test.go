@@ -0,0 +1,100 @@
+package ffmpeg_test
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"video-downloader-go/internal/lib/ffmpeg"
+)
+
+func TestParseDuration(t *testing.T) {
+	output := "Input #0, mpegts, from 'a.ts':\n  Duration: 01:02:03.50, start: 1.400000, bitrate: 1024 kb/s"
+	d, ok := ffmpeg.ParseDuration(output)
+	if !ok {
+		t.Fatal("解析失败")
+	}
+	want := time.Hour + 2*time.Minute + 3*time.Second + 500*time.Millisecond
+	if d != want {
+		t.Fatalf("期望 %v, 实际 %v", want, d)
+	}
+
+	if _, ok = ffmpeg.ParseDuration("Duration: N/A"); ok {
+		t.Fatal("未知时长不应解析成功")
+	}
+}
+
+func TestCalcProgress(t *testing.T) {
+	percent, eta := ffmpeg.CalcProgress(30*time.Second, 60*time.Second, 10*time.Second)
+	if percent != 50 || eta != 10*time.Second {
+		t.Fatalf("percent: %d, eta: %v", percent, eta)
+	}
+
+	// 未收到结束信号前不会达到 100%
+	if percent, _ = ffmpeg.CalcProgress(time.Minute, time.Minute, time.Second); percent != 99 {
+		t.Fatalf("percent: %d", percent)
+	}
+
+	if percent, eta = ffmpeg.CalcProgress(time.Second, 0, time.Second); percent != -1 || eta != -1 {
+		t.Fatalf("percent: %d, eta: %v", percent, eta)
+	}
+}
+
+func TestRunWithProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 sh")
+	}
+
+	script := `echo out_time_us=5000000; echo progress=continue; echo out_time_ms=10000000; echo progress=end`
+	var percents []int
+	err := ffmpeg.RunWithProgress(exec.Command("sh", "-c", script), 10*time.Second, func(percent int, eta, processed time.Duration) {
+		percents = append(percents, percent)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(percents) != 3 || percents[0] != 50 || percents[1] != 99 || percents[2] != 100 {
+		t.Fatalf("进度回调异常: %v", percents)
+	}
+}
+
+func TestRunWithProgressStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 sh")
+	}
+
+	script := `echo out_time_us=1000000; echo "concat.ts: Invalid data found when processing input" >&2; exit 1`
+	err := ffmpeg.RunWithProgress(exec.Command("sh", "-c", script), 0, nil)
+	if err == nil {
+		t.Fatal("期望返回错误")
+	}
+	if !strings.Contains(err.Error(), "Invalid data found when processing input") {
+		t.Fatalf("错误信息中缺少 stderr: %v", err)
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	output := `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'a.mp4':
+  Duration: 00:20:00.04, start: 0.000000, bitrate: 2048 kb/s
+  Stream #0:0[0x1](und): Video: h264 (High) (avc1 / 0x31637661), yuv420p, 1920x1080, 25 fps
+  Stream #0:1[0x2](und): Audio: aac (LC) (mp4a / 0x6134706D), 44100 Hz, stereo, fltp
+At least one output file must be specified`
+	pr, err := ffmpeg.ParseProbe(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Format != "mov,mp4,m4a,3gp,3g2,mj2" {
+		t.Fatalf("封装格式异常: %v", pr.Format)
+	}
+	if pr.Duration != 20*time.Minute+40*time.Millisecond {
+		t.Fatalf("时长异常: %v", pr.Duration)
+	}
+	if pr.Count(ffmpeg.StreamVideo) != 1 || pr.Count(ffmpeg.StreamAudio) != 1 || pr.Streams[0].Codec != "h264" {
+		t.Fatalf("流信息异常: %v", pr.Streams)
+	}
+
+	if _, err = ffmpeg.ParseProbe("[mov,mp4,m4a,3gp,3g2,mj2 @ 0x0] moov atom not found\na.mp4: Invalid data found when processing input"); err == nil {
+		t.Fatal("损坏的文件应该返回错误")
+	}
+}
@@ -0,0 +1,120 @@
+// 定义可持久化的任务记录, 程序重启后可以从记录的状态继续处理
+
+package meta
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"video-downloader-go/internal/util/mylog/dlbar"
+)
+
+// TaskState 任务状态
+type TaskState string
+
+const (
+	TaskQueued      TaskState = "queued"      // 等待解析
+	TaskDecoding    TaskState = "decoding"    // 正在解析
+	TaskDecoded     TaskState = "decoded"     // 解析完成, 等待下载
+	TaskDownloading TaskState = "downloading" // 正在下载
+	TaskMerging     TaskState = "merging"     // 下载完成, 正在合并、校验以及后处理
+	TaskDone        TaskState = "done"        // 处理完成
+	TaskFailed      TaskState = "failed"      // 处理失败
+)
+
+// DefaultLinkTTL 无法从下载地址中识别出过期时间时, 认为解析结果在这段时间内有效
+const DefaultLinkTTL = 30 * time.Minute
+
+// linkExpireParams 下载地址中常见的过期时间参数, 值为 unix 时间戳 (秒)
+var linkExpireParams = []string{"expires", "Expires", "expire", "deadline", "x-expires", "e"}
+
+// minExpireUnix 过期时间参数的最小值 (2001-09-09), 用于排除同名的非时间戳参数
+const minExpireUnix = 1e9
+
+// Task 一个任务的持久化记录, 包含了从解析到下载完成所需要的全部信息
+type Task struct {
+	Id        string            `json:"id"`                 // 任务 id
+	Name      string            `json:"name"`               // 视频名称
+	Url       string            `json:"url"`                // 源视频地址
+	State     TaskState         `json:"state"`              // 当前状态
+	Streams   []Stream          `json:"streams,omitempty"`  // 解析得到的媒体流
+	Resource  ResourceType      `json:"resource,omitempty"` // 资源类型提示
+	Vars      map[string]string `json:"vars,omitempty"`     // 解析器提供的文件名模板变量
+	ExpireAt  time.Time         `json:"expire_at"`          // 下载地址的过期时间
+	Tries     int               `json:"tries,omitempty"`    // 已经失败的下载次数
+	Priority  int               `json:"priority,omitempty"` // 任务优先级
+	Headers   map[string]string `json:"headers,omitempty"`  // 任务配置中指定的请求头
+	Cookies   []*http.Cookie    `json:"cookies,omitempty"`  // 解析器提供的 cookie
+	Error     string            `json:"error,omitempty"`    // 最近一次失败的原因
+	UpdatedAt time.Time         `json:"updated_at"`         // 最近一次更新的时间
+}
+
+// Finished 判断任务是否已经处于终止状态
+func (t *Task) Finished() bool {
+	return t.State == TaskDone || t.State == TaskFailed
+}
+
+// Decoded 判断任务是否持有尚未过期的下载地址, 可以跳过解析直接下载
+func (t *Task) Decoded() bool {
+	switch t.State {
+	case TaskDecoded, TaskDownloading, TaskMerging:
+	default:
+		return false
+	}
+	return len(t.Streams) > 0 && (t.ExpireAt.IsZero() || time.Now().Before(t.ExpireAt))
+}
+
+// Video 将任务记录转换为解析任务
+func (t *Task) Video(bar *dlbar.Bar) *Video {
+	return &Video{Id: t.Id, LogBar: bar, Name: t.Name, Url: t.Url, Tries: t.Tries, Priority: t.Priority, Headers: t.Headers}
+}
+
+// Download 将任务记录转换为下载任务
+func (t *Task) Download(bar *dlbar.Bar) *Download {
+	dmt := (&DecodeResult{Streams: t.Streams, Resource: t.Resource, Meta: t.Vars, ExpireAt: t.ExpireAt, Cookies: t.Cookies}).Download(t.Name, t.Url)
+	dmt.Id, dmt.LogBar = t.Id, bar
+	dmt.Tries, dmt.Priority = t.Tries, t.Priority
+	dmt.SetHeaders(t.Headers)
+	return dmt
+}
+
+// SetDownload 记录解析得到的下载信息
+func (t *Task) SetDownload(dmt *Download) {
+	t.Streams, t.Resource, t.Vars, t.ExpireAt = dmt.Streams, dmt.Resource, dmt.Vars, dmt.ExpireAt
+	t.Cookies = dmt.Cookies
+}
+
+// ClearDownload 清除解析得到的下载信息, 任务需要重新解析
+func (t *Task) ClearDownload() {
+	t.Streams, t.Resource, t.Vars, t.ExpireAt = nil, ResourceUnknown, nil, time.Time{}
+	t.Cookies = nil
+}
+
+// LinkExpireAt 推测下载地址的过期时间
+//
+// 优先读取地址中的过期时间参数, 识别不到时按照 DefaultLinkTTL 计算,
+// 多个下载地址取最早的过期时间
+func LinkExpireAt(links ...string) time.Time {
+	now := time.Now()
+	ans := now.Add(DefaultLinkTTL)
+	for _, l := range links {
+		u, err := url.Parse(l)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		for _, key := range linkExpireParams {
+			sec, err := strconv.ParseInt(query.Get(key), 10, 64)
+			if err != nil || sec < minExpireUnix {
+				// 值过小时通常不是时间戳
+				continue
+			}
+			if t := time.Unix(sec, 0); t.Before(ans) {
+				ans = t
+			}
+			break
+		}
+	}
+	return ans
+}
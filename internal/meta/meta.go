@@ -2,48 +2,113 @@ package meta
 
 import (
 	"fmt"
-	"strings"
+	"net/http"
+	"time"
+	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/util/myhttp"
 	"video-downloader-go/internal/util/mylog/dlbar"
-
-	"github.com/google/uuid"
 )
 
-// 用于分割下载链接的分割串
-var YtdlLinksSep = uuid.New().String()
-
 // 视频文件元数据
 type Video struct {
-	LogBar *dlbar.Bar // 日志任务条
-	Name   string     // 视频名称
-	Url    string     // 视频地址
+	Id       string            // 任务 id, 解析和下载阶段共用
+	LogBar   *dlbar.Bar        // 日志任务条
+	Name     string            // 视频名称
+	Url      string            // 视频地址
+	Tries    int               // 已经失败的下载次数, 重新解析时从下载任务中继承
+	Priority int               // 任务优先级, 越大越优先处理
+	Headers  map[string]string // 任务配置中指定的请求头, 覆盖其他来源的同名请求头
 }
 
 // Download 封装了一个视频下载任务所需要的元数据
 type Download struct {
+	Id        string            // 任务 id, 与解析阶段的 Video 一致
 	LogBar    *dlbar.Bar        // 日志任务条
-	Link      string            // 视频下载地址
+	Link      string            // 主下载地址, 即第一个媒体流的下载地址
+	Streams   []Stream          // 解析得到的全部媒体流, 音视频分离时包含多个
+	Resource  ResourceType      // 资源类型提示, 为空时由下载器自行识别
+	Name      string            // 任务名称, 即 data.txt 中配置的视频名称, 不会随着下载过程改变
 	FileName  string            // 视频名称
 	OriginUrl string            // 源视频地址
-	HeaderMap map[string]string // 请求头
+	HeaderMap map[string]string // 主下载地址的请求头
+	Vars      map[string]string // 解析器提供的文件名模板变量, 如 series, season, quality
+	ExpireAt  time.Time         // 下载地址的过期时间, 零值表示不会过期
+	Tries     int               // 已经失败的下载次数
+	StartAt   time.Time         // 第一次开始下载的时间, 用于统计耗时
+	Priority  int               // 任务优先级, 越大越优先处理
+	Headers   map[string]string // 任务配置中指定的请求头, 已经合并到每个媒体流的请求头中
+	Cookies   []*http.Cookie    // 解析器提供的 cookie, 已经写入 Jar 中
+	Jar       http.CookieJar    // 任务的 cookie jar, 下载过程中的所有请求共用
+	Subtitles []string          // 已下载的字幕文件, 与视频文件同名, 随视频文件一起清理和移动
+
+	// 下载器在下载过程中得知的预期结果, 用于下载完成后校验文件, 未知时为 0
+	ExpectedDuration time.Duration // 预期时长
+	ExpectedStreams  int           // 预期的媒体流个数
 }
 
-// 创建一个适配 youtube-dl 的下载元数据
-func NewYtDlDownloadMeta(links []string, fileName, originUrl string) *Download {
-	return NewDownloadMeta(strings.Join(links, YtdlLinksSep), fileName, originUrl)
+// NewDownloadMeta 用于创建一个默认的下载元数据, 只包含一个完整资源
+func NewDownloadMeta(link, fileName, originUrl string) *Download {
+	return NewDecodeResult(link).Download(fileName, originUrl)
 }
 
-// 将一个 link 分割为 link 数组
-func Split2YtDlLinks(link string) []string {
-	return strings.Split(link, YtdlLinksSep)
+// newDownload 使用已经补全请求头的媒体流创建下载元数据, streams 不能为空
+func newDownload(streams []Stream, fileName, originUrl string) *Download {
+	primary := streams[primaryStream(streams)]
+	return &Download{
+		Link:      primary.Url,
+		Streams:   streams,
+		HeaderMap: primary.HeaderMap,
+		Name:      fileName,
+		FileName:  fileName,
+		OriginUrl: originUrl,
+		Vars:      map[string]string{},
+	}
 }
 
-// NewDownloadMeta 用于创建一个默认的下载元数据
-func NewDownloadMeta(link, fileName, originUrl string) *Download {
-	dm := Download{Link: link, FileName: fileName, OriginUrl: originUrl}
-	m := myhttp.GenDefaultHeaderMapByUrl(nil, link)
-	dm.HeaderMap = m
-	return &dm
+// SetHeaders 记录任务配置中指定的请求头, 并覆盖每个媒体流中的同名请求头
+func (d *Download) SetHeaders(headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	d.Headers = headers
+	for i := range d.Streams {
+		s := &d.Streams[i]
+		if s.HeaderMap == nil {
+			s.HeaderMap = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			config.SetHeader(s.HeaderMap, k, v)
+		}
+	}
+	d.HeaderMap = d.Streams[primaryStream(d.Streams)].HeaderMap
+}
+
+// primaryStream 返回主下载地址所在的媒体流下标, 即第一个需要合并到输出文件中的媒体流
+// 没有这样的媒体流时返回 0
+func primaryStream(streams []Stream) int {
+	for i := range streams {
+		if streams[i].Media() {
+			return i
+		}
+	}
+	return 0
+}
+
+// HeadersOf 返回请求 link 时使用的请求头, link 可以是主下载地址以外的地址, 如 ts 分片和密钥
+//
+// 在主下载地址的请求头基础上合并 link 匹配到的请求头规则, 任务配置中指定的请求头始终优先
+func (d *Download) HeadersOf(link string) map[string]string {
+	return mergeHeaders(d.HeaderMap, link, d.Headers)
+}
+
+// Client 返回下载过程中发送请求使用的客户端, 使用任务的 cookie jar 以及源视频地址对应的代理和连接池
+func (d *Download) Client() *http.Client {
+	return myhttp.NewClient(d.Jar, myhttp.ProfileOf(d.OriginUrl))
+}
+
+// MultiStream 判断任务是否需要分别下载多个媒体流再合并
+func (d *Download) MultiStream() bool {
+	return len(d.Streams) > 1
 }
 
 // 格式化输出
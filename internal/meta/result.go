@@ -0,0 +1,137 @@
+// 定义解析器的解析结果
+
+package meta
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/util/myhttp"
+)
+
+// StreamRole 媒体流在最终文件中的作用
+type StreamRole string
+
+const (
+	StreamMuxed    StreamRole = "muxed"    // 同时包含音视频的完整资源
+	StreamVideo    StreamRole = "video"    // 仅视频
+	StreamAudio    StreamRole = "audio"    // 仅音频
+	StreamSubtitle StreamRole = "subtitle" // 字幕, 下载后与输出文件放在同一目录
+)
+
+// ResourceType 资源类型提示, 为空时由下载器根据下载地址自行识别
+type ResourceType string
+
+const (
+	ResourceUnknown ResourceType = ""
+	ResourceMP4     ResourceType = "mp4"  // 可以直接下载的单个文件
+	ResourceM3U8    ResourceType = "m3u8" // m3u8 播放列表
+)
+
+// Stream 解析得到的一个媒体流
+type Stream struct {
+	Url       string            `json:"url"`                  // 下载地址
+	Role      StreamRole        `json:"role,omitempty"`       // 媒体流的作用, 为空时视为 StreamMuxed
+	HeaderMap map[string]string `json:"header_map,omitempty"` // 下载该媒体流需要的请求头, Cookie 也放在这里
+}
+
+// Media 判断媒体流是否需要合并到输出文件中
+func (s *Stream) Media() bool {
+	return s.Role != StreamSubtitle
+}
+
+// DecodeResult 解析器的解析结果
+type DecodeResult struct {
+	Streams  []Stream          // 媒体流列表, 至少包含一个需要合并到输出文件中的媒体流
+	Resource ResourceType      // 资源类型提示, 对所有音视频流生效, 字幕流总是直接下载
+	Title    string            // 解析到的视频标题, 作为文件名模板变量 title
+	Meta     map[string]string // 其他元数据, 如 series, season, quality, 作为文件名模板变量
+	ExpireAt time.Time         // 下载地址的过期时间, 零值时由解析流程根据下载地址推测
+	Cookies  []*http.Cookie    // 下载时需要携带的 cookie, Domain 为空时对所有媒体流的域名生效
+}
+
+// NewDecodeResult 使用下载地址创建只包含一个完整资源的解析结果
+func NewDecodeResult(link string) *DecodeResult {
+	return &DecodeResult{Streams: []Stream{{Url: link, Role: StreamMuxed}}}
+}
+
+// Links 返回所有媒体流的下载地址
+func (r *DecodeResult) Links() []string {
+	return StreamLinks(r.Streams)
+}
+
+// StreamLinks 返回媒体流列表的下载地址
+func StreamLinks(streams []Stream) []string {
+	links := make([]string, 0, len(streams))
+	for _, s := range streams {
+		links = append(links, s.Url)
+	}
+	return links
+}
+
+// Download 使用解析结果创建下载任务
+//
+// 媒体流的请求头会合并根据下载地址生成的默认请求头以及匹配到的请求头规则, 第一个音视频流作为主下载地址
+func (r *DecodeResult) Download(fileName, originUrl string) *Download {
+	streams := make([]Stream, 0, len(r.Streams))
+	for _, s := range r.Streams {
+		if s.Role == "" {
+			s.Role = StreamMuxed
+		}
+		s.HeaderMap = mergeHeaders(s.HeaderMap, s.Url, nil)
+		streams = append(streams, s)
+	}
+
+	dmt := newDownload(streams, fileName, originUrl)
+	dmt.Resource = r.Resource
+	for k, v := range r.Meta {
+		dmt.Vars[k] = v
+	}
+	if r.Title != "" {
+		dmt.Vars["title"] = r.Title
+	}
+	dmt.ExpireAt = r.ExpireAt
+	dmt.Cookies, dmt.Jar = r.Cookies, newCookieJar(streams, r.Cookies)
+	return dmt
+}
+
+// mergeHeaders 复制 base 并合并请求 link 时需要的请求头, 优先级从低到高依次为:
+// base 中的请求头、内置的默认请求头、请求头规则、overrides
+func mergeHeaders(base map[string]string, link string, overrides map[string]string) map[string]string {
+	headers := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		headers[k] = v
+	}
+	myhttp.GenDefaultHeaderMapByUrl(headers, link)
+	config.ApplyHeaderRules(headers, link)
+	for k, v := range overrides {
+		config.SetHeader(headers, k, v)
+	}
+	return headers
+}
+
+// newCookieJar 创建任务的 cookie jar, 依次写入请求头规则中的 cookie 文件以及解析器提供的 cookie
+//
+// 同一个任务的所有请求共用这个 jar, 响应中的 Set-Cookie 会对之后的请求生效
+func newCookieJar(streams []Stream, cookies []*http.Cookie) http.CookieJar {
+	// 不传入 PublicSuffixList 时不会返回错误
+	jar, _ := cookiejar.New(nil)
+	links := StreamLinks(streams)
+	config.SeedCookieJar(jar, links...)
+
+	for _, c := range cookies {
+		if c.Domain != "" {
+			jar.SetCookies(&url.URL{Scheme: "https", Host: strings.TrimPrefix(c.Domain, "."), Path: "/"}, []*http.Cookie{c})
+			continue
+		}
+		for _, link := range links {
+			if u, err := url.Parse(link); err == nil {
+				jar.SetCookies(u, []*http.Cookie{c})
+			}
+		}
+	}
+	return jar
+}
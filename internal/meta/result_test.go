@@ -0,0 +1,113 @@
+package meta_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+	"video-downloader-go/internal/meta"
+)
+
+func TestDecodeResultDownload(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	res := &meta.DecodeResult{
+		Streams: []meta.Stream{
+			{Url: "https://upos.bilivideo.com/v.m4s", HeaderMap: map[string]string{"Cookie": "a=1"}},
+			{Url: "https://upos.bilivideo.com/a.m4s", Role: meta.StreamAudio},
+			{Url: "https://upos.bilivideo.com/zh.srt", Role: meta.StreamSubtitle},
+		},
+		Resource: meta.ResourceMP4,
+		Title:    "标题",
+		Meta:     map[string]string{"quality": "1080P"},
+		ExpireAt: expire,
+	}
+	dmt := res.Download("第一集", "https://www.bilibili.com/video/1")
+
+	if dmt.Link != res.Streams[0].Url || !dmt.MultiStream() || dmt.Resource != meta.ResourceMP4 {
+		t.Fatalf("下载任务的媒体流异常: %+v", dmt)
+	}
+	if dmt.Streams[0].Role != meta.StreamMuxed || dmt.Streams[2].Media() {
+		t.Fatalf("媒体流的作用异常: %+v", dmt.Streams)
+	}
+	// 解析器提供的请求头与默认请求头合并, 并且不修改解析结果本身
+	if dmt.HeaderMap["Cookie"] != "a=1" || dmt.Streams[1].HeaderMap["Referer"] == "" {
+		t.Fatalf("请求头异常: %+v", dmt.Streams)
+	}
+	if _, ok := res.Streams[0].HeaderMap["Referer"]; ok {
+		t.Fatal("创建下载任务时不应该修改解析结果")
+	}
+	if dmt.Vars["title"] != "标题" || dmt.Vars["quality"] != "1080P" || !dmt.ExpireAt.Equal(expire) {
+		t.Fatalf("元数据异常: %v, %v", dmt.Vars, dmt.ExpireAt)
+	}
+}
+
+func TestDownloadHeaders(t *testing.T) {
+	res := &meta.DecodeResult{Streams: []meta.Stream{
+		{Url: "https://a.com/v.m3u8", HeaderMap: map[string]string{"referer": "decoder", "Cookie": "a=1"}},
+		{Url: "https://a.com/a.m3u8", Role: meta.StreamAudio},
+	}}
+	dmt := res.Download("第一集", "https://a.com/1")
+	dmt.SetHeaders(map[string]string{"Referer": "task"})
+
+	// 任务指定的请求头覆盖每个媒体流中的同名请求头
+	for _, s := range dmt.Streams {
+		if s.HeaderMap["Referer"] != "task" || s.HeaderMap["referer"] != "" {
+			t.Fatalf("媒体流的请求头异常: %v", s.HeaderMap)
+		}
+	}
+	if h := dmt.HeadersOf("https://b.com/1.ts"); h["Referer"] != "task" || h["Cookie"] != "a=1" {
+		t.Fatalf("分片的请求头异常: %v", h)
+	}
+	// HeadersOf 返回副本, 不影响任务本身的请求头
+	dmt.HeadersOf(dmt.Link)["Cookie"] = "b=2"
+	if dmt.HeaderMap["Cookie"] != "a=1" {
+		t.Fatalf("不应该修改任务的请求头: %v", dmt.HeaderMap)
+	}
+}
+
+func TestDownloadCookieJar(t *testing.T) {
+	res := meta.NewDecodeResult("https://v.a.com/v.m3u8")
+	res.Cookies = []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".a.com"},
+	}
+	dmt := res.Download("第一集", "https://a.com/1")
+
+	cookies := func(rawUrl string) map[string]string {
+		u, _ := url.Parse(rawUrl)
+		ans := map[string]string{}
+		for _, c := range dmt.Jar.Cookies(u) {
+			ans[c.Name] = c.Value
+		}
+		return ans
+	}
+	// 没有指定域名的 cookie 只对媒体流的域名生效
+	if c := cookies("https://v.a.com/1.ts"); c["host"] != "1" || c["domain"] != "2" {
+		t.Fatalf("媒体流域名的 cookie 异常: %v", c)
+	}
+	if c := cookies("https://cdn.a.com/1.ts"); c["host"] != "" || c["domain"] != "2" {
+		t.Fatalf("其他子域名的 cookie 异常: %v", c)
+	}
+
+	// 从任务记录恢复时重新创建 jar
+	task := &meta.Task{Name: dmt.Name, Url: dmt.OriginUrl}
+	task.SetDownload(dmt)
+	if restored := task.Download(nil); restored.Jar == dmt.Jar || len(restored.Cookies) != 2 {
+		t.Fatalf("恢复的 cookie 异常: %+v", restored.Cookies)
+	}
+}
+
+func TestDownloadPrimaryStream(t *testing.T) {
+	res := &meta.DecodeResult{Streams: []meta.Stream{
+		{Url: "https://a.com/zh.vtt", Role: meta.StreamSubtitle, HeaderMap: map[string]string{"Referer": "sub"}},
+		{Url: "https://a.com/v.m3u8", HeaderMap: map[string]string{"Referer": "video"}},
+	}, Resource: meta.ResourceM3U8}
+	dmt := res.Download("第一集", "https://a.com/1")
+	if dmt.Link != "https://a.com/v.m3u8" || dmt.HeaderMap["Referer"] != "video" {
+		t.Fatalf("字幕流不应该作为主下载地址: %s, %v", dmt.Link, dmt.HeaderMap)
+	}
+	dmt.SetHeaders(map[string]string{"Origin": "task"})
+	if dmt.HeaderMap["Referer"] != "video" || dmt.HeaderMap["Origin"] != "task" {
+		t.Fatalf("设置请求头后主下载地址的请求头异常: %v", dmt.HeaderMap)
+	}
+}
@@ -1,46 +1,163 @@
 // 定义用于命令行下载器的任务列表类型
-
 package meta
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQueueClosed 队列已关闭并且没有剩余的元素
+var ErrQueueClosed = errors.New("任务队列已关闭")
+
+const (
+	PriorityDefault      = 0               // 默认的任务优先级
+	DefaultPriorityAging = 5 * time.Minute // 默认的老化周期, 任务每等待一个周期优先级加 1
+)
+
+// dequeItem 队列中的一个元素
+type dequeItem[T any] struct {
+	val        *T
+	priority   int       // 基础优先级
+	seq        int64     // 加入顺序, 相同优先级时越小越靠前
+	enqueuedAt time.Time // 加入队列的时间, 用于计算老化后的优先级
+}
 
 // 任务列表双端队列结构，泛型取值为 Video 和 Download
+//
+// 元素按照优先级从高到低取出, 相同优先级的元素保持加入的顺序,
+// 开启老化后, 元素每等待一个老化周期优先级加 1, 避免低优先级的任务一直得不到处理,
+// 零值可以直接使用, 所有方法都可以在多个协程中并发调用
 type TaskDeque[T any] struct {
-	list []*T       // 存储数据的切片
-	mu   sync.Mutex // 协程同步
+	list     []dequeItem[T] // 存储数据的切片, 按照加入顺序排列
+	mu       sync.Mutex     // 协程同步
+	cond     *sync.Cond     // 有新元素加入或者队列关闭时通知等待中的消费者
+	closed   bool           // 队列是否已关闭
+	aging    time.Duration  // 老化周期, 为 0 时不老化
+	firstSeq int64          // 从队首加入的元素使用的序号, 递减
+	lastSeq  int64          // 从队尾加入的元素使用的序号, 递增
+}
+
+// notify 唤醒所有等待中的消费者, 调用方需要持有锁
+func (td *TaskDeque[T]) notify() {
+	if td.cond != nil {
+		td.cond.Broadcast()
+	}
+}
+
+// SetAging 设置老化周期, 为 0 时不老化
+func (td *TaskDeque[T]) SetAging(aging time.Duration) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.aging = aging
+}
+
+// effectivePriority 计算元素老化后的优先级, 调用方需要持有锁
+func (td *TaskDeque[T]) effectivePriority(item *dequeItem[T], now time.Time) int {
+	if td.aging <= 0 {
+		return item.priority
+	}
+	return item.priority + int(now.Sub(item.enqueuedAt)/td.aging)
+}
+
+// ordered 返回按照取出顺序排列的元素下标, 调用方需要持有锁
+func (td *TaskDeque[T]) ordered() []int {
+	now := time.Now()
+	idx := make([]int, len(td.list))
+	prio := make([]int, len(td.list))
+	for i := range td.list {
+		idx[i], prio[i] = i, td.effectivePriority(&td.list[i], now)
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ia, ib := idx[a], idx[b]
+		if prio[ia] != prio[ib] {
+			return prio[ia] > prio[ib]
+		}
+		return td.list[ia].seq < td.list[ib].seq
+	})
+	return idx
 }
 
-// Range 用于遍历队列元素
+// Range 用于遍历队列元素, 遍历顺序与取出顺序一致
+//
+// 遍历的是调用时队列的快照, 在 itemHandler 中修改队列不会影响本次遍历
 func (td *TaskDeque[T]) Range(itemHandler func(item *T, index int)) {
-	for i := 0; i < td.Size(); i++ {
-		itemHandler(td.Get(i), i)
+	td.mu.Lock()
+	snapshot := make([]*T, 0, len(td.list))
+	for _, i := range td.ordered() {
+		snapshot = append(snapshot, td.list[i].val)
+	}
+	td.mu.Unlock()
+
+	for i, val := range snapshot {
+		itemHandler(val, i)
 	}
 }
 
-// OfferLast 从队尾添加一个元素
-func (td *TaskDeque[T]) OfferLast(val *T) {
+// Offer 按照优先级添加一个元素, 排在相同优先级的元素之后
+func (td *TaskDeque[T]) Offer(val *T, priority int) {
 	td.mu.Lock()
 	defer td.mu.Unlock()
-	td.list = append(td.list, val)
+	td.lastSeq++
+	td.add(dequeItem[T]{val: val, priority: priority, seq: td.lastSeq})
+}
+
+// OfferLast 以默认优先级从队尾添加一个元素
+func (td *TaskDeque[T]) OfferLast(val *T) {
+	td.Offer(val, PriorityDefault)
 }
 
-// OfferFirst 从队首添加一个元素
+// OfferFirst 以默认优先级从队首添加一个元素, 排在相同优先级的元素之前
 func (td *TaskDeque[T]) OfferFirst(val *T) {
 	td.mu.Lock()
 	defer td.mu.Unlock()
-	td.list = append([]*T{val}, td.list...)
+	td.firstSeq--
+	td.add(dequeItem[T]{val: val, priority: PriorityDefault, seq: td.firstSeq})
+}
+
+// add 添加元素并唤醒消费者, 调用方需要持有锁
+func (td *TaskDeque[T]) add(item dequeItem[T]) {
+	item.enqueuedAt = time.Now()
+	td.list = append(td.list, item)
+	td.notify()
+}
+
+// Reprioritize 修改队列中元素的优先级
+//
+// fn 返回 false 时不修改该元素, 修改后重新计算老化时间
+// @return 修改的元素个数
+func (td *TaskDeque[T]) Reprioritize(fn func(val *T) (int, bool)) int {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	cnt := 0
+	now := time.Now()
+	for i := range td.list {
+		priority, ok := fn(td.list[i].val)
+		if !ok || priority == td.list[i].priority {
+			continue
+		}
+		td.list[i].priority, td.list[i].enqueuedAt = priority, now
+		cnt++
+	}
+	return cnt
 }
 
-// Get 返回队列指定索引的元素，越界返回空
+// Get 返回队列中按照取出顺序排列的指定索引的元素，越界返回空
 func (td *TaskDeque[T]) Get(index int) *T {
-	if index < 0 || index >= td.Size() {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if index < 0 || index >= len(td.list) {
 		return nil
 	}
-	return td.list[index]
+	return td.list[td.ordered()[index]].val
 }
 
 // Size 返回队列的大小
 func (td *TaskDeque[T]) Size() int {
+	td.mu.Lock()
+	defer td.mu.Unlock()
 	return len(td.list)
 }
 
@@ -53,22 +170,113 @@ func (td *TaskDeque[T]) Empty() bool {
 func (td *TaskDeque[T]) PollFirst() *T {
 	td.mu.Lock()
 	defer td.mu.Unlock()
-	if td.Empty() {
+	return td.pollFirst()
+}
+
+// pollFirst 取出优先级最高的元素, 调用方需要持有锁
+func (td *TaskDeque[T]) pollFirst() *T {
+	if len(td.list) == 0 {
 		return nil
 	}
-	val := td.list[0]
-	td.list = td.list[1:]
-	return val
+	now := time.Now()
+	best, bestPrio := 0, td.effectivePriority(&td.list[0], now)
+	for i := 1; i < len(td.list); i++ {
+		prio := td.effectivePriority(&td.list[i], now)
+		if prio > bestPrio || (prio == bestPrio && td.list[i].seq < td.list[best].seq) {
+			best, bestPrio = i, prio
+		}
+	}
+	return td.remove(best)
 }
 
 // PollLast 返回队尾元素，如果队列为空，返回 nil
 func (td *TaskDeque[T]) PollLast() *T {
 	td.mu.Lock()
 	defer td.mu.Unlock()
-	if td.Empty() {
+	if len(td.list) == 0 {
 		return nil
 	}
-	val := td.list[td.Size()-1]
-	td.list = td.list[:td.Size()-1]
+	order := td.ordered()
+	return td.remove(order[len(order)-1])
+}
+
+// remove 移除指定下标的元素, 调用方需要持有锁
+func (td *TaskDeque[T]) remove(i int) *T {
+	val := td.list[i].val
+	copy(td.list[i:], td.list[i+1:])
+	td.list[len(td.list)-1] = dequeItem[T]{}
+	td.list = td.list[:len(td.list)-1]
 	return val
 }
+
+// Take 取出队首元素, 队列为空时阻塞等待, 直到有新元素加入
+//
+// 队列关闭后会继续返回剩余的元素, 取完后返回 ErrQueueClosed;
+// ctx 结束时返回 ctx.Err()
+func (td *TaskDeque[T]) Take(ctx context.Context) (*T, error) {
+	return td.TakeMatch(ctx, nil)
+}
+
+// TakeMatch 按照取出顺序取出第一个满足 match 的元素, 没有满足的元素时阻塞等待
+//
+// match 在持有队列锁的情况下调用, 返回 true 的元素会被取出, 因此可以在 match 中占用资源;
+// match 依赖的外部状态变化时, 需要调用 Notify 唤醒等待中的消费者重新检查,
+// 队列关闭并且取完所有元素后返回 ErrQueueClosed, match 为 nil 时等同于 Take
+func (td *TaskDeque[T]) TakeMatch(ctx context.Context, match func(val *T) bool) (*T, error) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if td.cond == nil {
+		td.cond = sync.NewCond(&td.mu)
+	}
+
+	// ctx 结束时唤醒等待中的消费者, 由消费者自行检查 ctx 状态
+	stop := context.AfterFunc(ctx, func() {
+		td.mu.Lock()
+		defer td.mu.Unlock()
+		td.cond.Broadcast()
+	})
+	defer stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if val := td.pollMatch(match); val != nil {
+			return val, nil
+		}
+		if td.closed && len(td.list) == 0 {
+			return nil, ErrQueueClosed
+		}
+		td.cond.Wait()
+	}
+}
+
+// pollMatch 取出第一个满足 match 的元素, 调用方需要持有锁
+func (td *TaskDeque[T]) pollMatch(match func(val *T) bool) *T {
+	if match == nil {
+		return td.pollFirst()
+	}
+	for _, i := range td.ordered() {
+		if match(td.list[i].val) {
+			return td.remove(i)
+		}
+	}
+	return nil
+}
+
+// Notify 唤醒所有等待中的消费者, 重新检查是否有可以取出的元素
+func (td *TaskDeque[T]) Notify() {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.notify()
+}
+
+// Close 关闭队列, 唤醒所有等待中的消费者
+//
+// 关闭后仍然可以添加元素, 消费者在取完所有元素后才会收到 ErrQueueClosed
+func (td *TaskDeque[T]) Close() {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.closed = true
+	td.notify()
+}
@@ -0,0 +1,197 @@
+package meta_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"video-downloader-go/internal/meta"
+)
+
+func TestTaskDequePriority(t *testing.T) {
+	td := new(meta.TaskDeque[int])
+	vals := []int{0, 1, 2, 3, 4}
+	td.OfferLast(&vals[0])
+	td.Offer(&vals[1], 5)
+	td.OfferLast(&vals[2])
+	td.Offer(&vals[3], 5)
+	td.OfferFirst(&vals[4])
+
+	want := []int{1, 3, 4, 0, 2}
+	for i, w := range want {
+		if got := *td.PollFirst(); got != w {
+			t.Fatalf("第 %d 个元素顺序异常, got: %d, want: %d", i, got, w)
+		}
+	}
+	if td.PollFirst() != nil || td.PollLast() != nil {
+		t.Fatal("空队列应该返回 nil")
+	}
+}
+
+func TestTaskDequeTake(t *testing.T) {
+	td := new(meta.TaskDeque[int])
+	val := 1
+
+	// 生产者加入元素后立即唤醒消费者
+	got := make(chan *int)
+	go func() {
+		v, _ := td.Take(context.Background())
+		got <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+	td.OfferLast(&val)
+	select {
+	case v := <-got:
+		if *v != 1 {
+			t.Fatalf("取出的元素异常: %d", *v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("加入元素后消费者没有被唤醒")
+	}
+
+	// ctx 结束时返回
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := td.Take(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx 结束时应该返回 ctx 的错误: %v", err)
+	}
+
+	// 关闭后先取完剩余的元素
+	td.OfferLast(&val)
+	td.Close()
+	if v, err := td.Take(context.Background()); err != nil || *v != 1 {
+		t.Fatalf("关闭后应该继续返回剩余的元素: %v", err)
+	}
+	if _, err := td.Take(context.Background()); !errors.Is(err, meta.ErrQueueClosed) {
+		t.Fatalf("关闭并取完后应该返回 ErrQueueClosed: %v", err)
+	}
+}
+
+func TestTaskDequeConcurrent(t *testing.T) {
+	const producers, perProducer = 8, 200
+	td := new(meta.TaskDeque[int])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var produceWg, consumeWg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < producers; i++ {
+		produceWg.Add(1)
+		go func(i int) {
+			defer produceWg.Done()
+			for j := 0; j < perProducer; j++ {
+				v := i*perProducer + j
+				if j%2 == 0 {
+					td.OfferLast(&v)
+				} else {
+					td.Offer(&v, j%5)
+				}
+				td.Range(func(item *int, index int) { _ = *item })
+				td.Size()
+				td.Get(0)
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		consumeWg.Add(1)
+		go func() {
+			defer consumeWg.Done()
+			for {
+				if _, err := td.Take(ctx); err != nil {
+					return
+				}
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	produceWg.Wait()
+	td.Close()
+	consumeWg.Wait()
+	if taken != producers*perProducer || !td.Empty() {
+		t.Fatalf("元素数量异常, taken: %d, remain: %d", taken, td.Size())
+	}
+}
+
+func TestTaskDequeAging(t *testing.T) {
+	td := new(meta.TaskDeque[int])
+	td.SetAging(20 * time.Millisecond)
+	low, high := 0, 1
+	td.Offer(&low, 0)
+	time.Sleep(50 * time.Millisecond)
+	td.Offer(&high, 1)
+
+	// 低优先级的任务等待了两个老化周期, 优先级已经超过新加入的任务
+	if got := *td.PollFirst(); got != low {
+		t.Fatalf("老化后的任务应该先被取出, got: %d", got)
+	}
+}
+
+func TestTaskDequeReprioritize(t *testing.T) {
+	td := new(meta.TaskDeque[int])
+	vals := []int{0, 1, 2}
+	for i := range vals {
+		td.OfferLast(&vals[i])
+	}
+	cnt := td.Reprioritize(func(v *int) (int, bool) {
+		return 10, *v == 2
+	})
+	if cnt != 1 || *td.Get(0) != 2 {
+		t.Fatalf("修改优先级后顺序异常, cnt: %d, first: %d", cnt, *td.Get(0))
+	}
+}
+
+func TestTaskDequeTakeMatch(t *testing.T) {
+	td := new(meta.TaskDeque[int])
+	vals := []int{0, 1, 2}
+	for i := range vals {
+		td.OfferLast(&vals[i])
+	}
+
+	// 跳过不满足条件的元素, 按照取出顺序返回第一个满足条件的元素
+	v, err := td.TakeMatch(context.Background(), func(v *int) bool { return *v > 0 })
+	if err != nil || *v != 1 {
+		t.Fatalf("取出的元素异常: %v", err)
+	}
+
+	// 没有满足条件的元素时阻塞, 条件变化后由 Notify 唤醒
+	var mu sync.Mutex
+	allow := false
+	got := make(chan *int)
+	go func() {
+		v, _ := td.TakeMatch(context.Background(), func(v *int) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return allow && *v == 0
+		})
+		got <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	allow = true
+	mu.Unlock()
+	td.Notify()
+	select {
+	case v := <-got:
+		if *v != 0 {
+			t.Fatalf("取出的元素异常: %d", *v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("条件变化后消费者没有被唤醒")
+	}
+
+	// 关闭后仍然等待剩余的元素满足条件, 不会提前返回 ErrQueueClosed
+	td.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := td.TakeMatch(ctx, func(v *int) bool { return false }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("还有剩余的元素时不应该返回 ErrQueueClosed: %v", err)
+	}
+	if v, err := td.Take(context.Background()); err != nil || *v != 2 {
+		t.Fatalf("关闭后应该继续返回剩余的元素: %v", err)
+	}
+}
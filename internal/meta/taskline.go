@@ -0,0 +1,88 @@
+// 解析任务文件 data.txt 中的任务配置
+
+package meta
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 任务文件中支持的选项
+const (
+	TaskOptionPriority = "priority" // 任务优先级, 整数, 越大越优先处理
+	TaskOptionHeader   = "header"   // 下载时使用的请求头, 格式为 `名称: 值`, 可以配置多个
+)
+
+// TaskLine 任务文件中的一行任务配置
+//
+// 格式: 名称|地址|选项1=值1|选项2=值2, 选项可以省略
+type TaskLine struct {
+	Name     string            // 视频名称
+	Url      string            // 视频地址
+	Priority int               // 任务优先级
+	Headers  map[string]string // 任务指定的请求头, 没有配置时为 nil
+}
+
+// ParseTaskLine 解析一行任务配置
+func ParseTaskLine(line string) (*TaskLine, error) {
+	arr := strings.Split(line, "|")
+	if len(arr) < 2 {
+		return nil, fmt.Errorf("任务格式不合法，请遵循：`文件名|地址|选项=值`：%s", line)
+	}
+	tl := &TaskLine{Name: strings.TrimSpace(arr[0]), Url: strings.TrimSpace(arr[1]), Priority: PriorityDefault}
+	if tl.Name == "" || tl.Url == "" {
+		return nil, fmt.Errorf("任务的文件名和地址不能为空：%s", line)
+	}
+
+	for _, opt := range arr[2:] {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return nil, fmt.Errorf("任务选项格式不合法，请遵循：`选项=值`：%s", opt)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case TaskOptionPriority:
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("任务优先级必须是整数：%s", opt)
+			}
+			tl.Priority = priority
+		case TaskOptionHeader:
+			name, hv, ok := strings.Cut(value, ":")
+			if name = strings.TrimSpace(name); !ok || name == "" || strings.ContainsAny(name, " \t") {
+				return nil, fmt.Errorf("请求头格式不合法，请遵循：`header=名称: 值`：%s", opt)
+			}
+			if tl.Headers == nil {
+				tl.Headers = make(map[string]string)
+			}
+			tl.Headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(hv)
+		default:
+			return nil, fmt.Errorf("不支持的任务选项：%s", key)
+		}
+	}
+	return tl, nil
+}
+
+// String 按照 ParseTaskLine 可以解析的格式输出任务配置, 没有配置的选项不输出
+func (tl *TaskLine) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(tl.Name + "|" + tl.Url)
+	if tl.Priority != PriorityDefault {
+		sb.WriteString("|" + TaskOptionPriority + "=" + strconv.Itoa(tl.Priority))
+	}
+	names := make([]string, 0, len(tl.Headers))
+	for name := range tl.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("|" + TaskOptionHeader + "=" + name + ": " + tl.Headers[name])
+	}
+	return sb.String()
+}
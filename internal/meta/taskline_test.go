@@ -0,0 +1,37 @@
+package meta_test
+
+import (
+	"testing"
+	"video-downloader-go/internal/meta"
+)
+
+func TestParseTaskLine(t *testing.T) {
+	tl, err := meta.ParseTaskLine("第一集|https://example.com/1")
+	if err != nil || tl.Name != "第一集" || tl.Url != "https://example.com/1" || tl.Priority != meta.PriorityDefault {
+		t.Fatalf("解析异常: %+v, %v", tl, err)
+	}
+
+	tl, err = meta.ParseTaskLine("第二集|https://example.com/2|priority=10|")
+	if err != nil || tl.Priority != 10 {
+		t.Fatalf("解析优先级异常: %+v, %v", tl, err)
+	}
+
+	tl, err = meta.ParseTaskLine("第三集|https://example.com/3|header=referer: https://example.com|header=Cookie: a=1; b=2")
+	if err != nil || tl.Headers["Referer"] != "https://example.com" || tl.Headers["Cookie"] != "a=1; b=2" {
+		t.Fatalf("解析请求头异常: %+v, %v", tl, err)
+	}
+
+	for _, line := range []string{
+		"第三集",
+		"|https://example.com/3",
+		"第三集|https://example.com/3|priority=high",
+		"第三集|https://example.com/3|unknown=1",
+		"第三集|https://example.com/3|priority",
+		"第三集|https://example.com/3|header=Referer",
+		"第三集|https://example.com/3|header=: v",
+	} {
+		if _, err = meta.ParseTaskLine(line); err == nil {
+			t.Errorf("不合法的任务配置应该返回错误: %s", line)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// 内置的后处理器
+package postproc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/transfer"
+	"video-downloader-go/internal/util/mytpl"
+
+	"github.com/pkg/errors"
+)
+
+// faststartProcessor 将 mp4 的 moov 移动到文件头部
+type faststartProcessor struct{}
+
+func (p *faststartProcessor) Name() string { return "faststart" }
+
+func (p *faststartProcessor) Process(dmt *meta.Download) error {
+	switch strings.ToLower(filepath.Ext(dmt.FileName)) {
+	case ".mp4", ".m4a", ".mov":
+	default:
+		// 其他容器没有 moov 的概念, 直接跳过
+		return nil
+	}
+	return remux(dmt, "正在优化文件结构", "-movflags", "+faststart")
+}
+
+// metadataProcessor 将配置的元数据写入文件
+type metadataProcessor struct {
+	metadata map[string]string
+}
+
+func (p *metadataProcessor) Name() string { return "metadata" }
+
+func (p *metadataProcessor) Process(dmt *meta.Download) error {
+	vars := Vars(dmt)
+	keys := make([]string, 0, len(p.metadata))
+	for k := range p.metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{}
+	for _, k := range keys {
+		args = append(args, "-metadata", fmt.Sprintf("%s=%s", k, mytpl.Render(p.metadata[k], vars)))
+	}
+	return remux(dmt, "正在写入元数据", args...)
+}
+
+// remux 调用 ffmpeg 以 copy 的方式重新封装文件, 完成后覆盖原文件
+func remux(dmt *meta.Download, hint string, args ...string) error {
+	dir, base := filepath.Split(dmt.FileName)
+	tmpPath := filepath.Join(dir, "remux_"+base)
+	defer os.Remove(tmpPath)
+
+	cmdArgs := []string{"-y", "-i", dmt.FileName, "-map", "0", "-c", "copy"}
+	cmdArgs = append(cmdArgs, args...)
+	cmdArgs = append(cmdArgs, tmpPath)
+	if err := ffmpeg.RunWithProgress(ffmpeg.Command(cmdArgs...), dmt.ExpectedDuration, transfer.ProgressHint(dmt.LogBar, hint)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dmt.FileName); err != nil {
+		return errors.Wrap(err, "覆盖原文件失败")
+	}
+	return nil
+}
+
+// moveProcessor 按照模板移动或重命名文件
+type moveProcessor struct {
+	target string
+}
+
+func (p *moveProcessor) Name() string { return "move" }
+
+func (p *moveProcessor) Process(dmt *meta.Download) error {
+	target := mytpl.Render(p.target, Vars(dmt))
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(dmt.FileName), target)
+	}
+	target = filepath.Clean(target)
+	if target == dmt.FileName {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "创建目标目录失败: %s", target)
+	}
+	if err := moveFile(dmt.FileName, target); err != nil {
+		return errors.Wrapf(err, "移动文件失败: %s", target)
+	}
+
+	// 字幕文件跟随视频文件移动, 并保持与视频文件同名
+	oldStem, newStem := trimExt(dmt.FileName), trimExt(target)
+	dmt.FileName = target
+	for i, sub := range dmt.Subtitles {
+		subTarget := filepath.Join(filepath.Dir(target), filepath.Base(sub))
+		if strings.HasPrefix(sub, oldStem) {
+			subTarget = newStem + strings.TrimPrefix(sub, oldStem)
+		}
+		if err := moveFile(sub, subTarget); err != nil {
+			return errors.Wrapf(err, "移动字幕文件失败: %s", subTarget)
+		}
+		dmt.Subtitles[i] = subTarget
+	}
+	return nil
+}
+
+// trimExt 去除路径中的文件后缀
+func trimExt(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// moveFile 移动文件, 跨设备时退化为拷贝后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// execProcessor 执行外部命令, 命令的每个参数都可以使用任务变量
+type execProcessor struct {
+	command []string
+}
+
+func (p *execProcessor) Name() string { return "exec" }
+
+func (p *execProcessor) Process(dmt *meta.Download) error {
+	vars := Vars(dmt)
+	args := make([]string, len(p.command))
+	for i, arg := range p.command {
+		args[i] = mytpl.Render(arg, vars)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	// 同时以环境变量的形式传递任务变量, 便于在脚本中使用
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, "VD_"+strings.ToUpper(k)+"="+v)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "执行命令失败, output: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// 下载完成后的后处理流程
+package postproc
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mylog"
+
+	"github.com/pkg/errors"
+)
+
+// PostProcessor 后处理器接口, 在文件下载并校验完成后按配置顺序执行
+//
+// 后处理器可以修改 dmt.FileName (如移动文件), 后续的后处理器会基于新的路径继续处理
+type PostProcessor interface {
+	// Name 后处理器名称, 用于展示和日志
+	Name() string
+
+	// Process 对已下载完成的任务执行后处理, 返回错误时任务失败
+	Process(dmt *meta.Download) error
+}
+
+// New 根据配置创建一个后处理器
+func New(cfg config.PostProcessor) (PostProcessor, error) {
+	switch cfg.Use {
+	case config.PostProcessFaststart:
+		return new(faststartProcessor), nil
+	case config.PostProcessMove:
+		return &moveProcessor{target: cfg.Target}, nil
+	case config.PostProcessMetadata:
+		return &metadataProcessor{metadata: cfg.Metadata}, nil
+	case config.PostProcessExec:
+		return &execProcessor{command: cfg.Command}, nil
+	default:
+		return nil, fmt.Errorf("不支持的后处理器类型: %s", cfg.Use)
+	}
+}
+
+// Chain 返回对任务生效的后处理器列表, 优先使用定制化配置
+func Chain(originUrl string) ([]PostProcessor, error) {
+	ans := []PostProcessor{}
+	for _, cfg := range config.CustomPostProcessors(originUrl) {
+		pp, err := New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ans = append(ans, pp)
+	}
+	return ans, nil
+}
+
+// Run 对下载完成的任务依次执行后处理, 任意一步失败时中止并返回错误
+func Run(dmt *meta.Download) error {
+	chain, err := Chain(dmt.OriginUrl)
+	if err != nil {
+		return errors.Wrap(err, "初始化后处理器失败")
+	}
+
+	for i, pp := range chain {
+		dmt.LogBar.PostProcessHint(fmt.Sprintf("正在后处理: %s (%d/%d)", pp.Name(), i+1, len(chain)))
+		if err = pp.Process(dmt); err != nil {
+			dmt.LogBar.ErrorHint(fmt.Sprintf("后处理失败: %s", pp.Name()))
+			return errors.Wrapf(err, "后处理失败: %s", pp.Name())
+		}
+		mylog.Infof("后处理完成: %s, 文件名: %s", pp.Name(), dmt.FileName)
+	}
+	return nil
+}
+
+// Vars 生成任务变量, 可在后处理器配置的模板中使用
+//
+//	{path}       文件的绝对路径
+//	{dir}        文件所在目录
+//	{filename}   文件名, 包含后缀
+//	{name}       文件名, 不包含后缀
+//	{ext}        文件后缀, 不包含 .
+//	{origin_url} 源视频地址
+//	{link}       视频下载地址
+//	{host}       源视频地址的域名
+//	{date}       当前日期, 格式: 2006-01-02
+func Vars(dmt *meta.Download) map[string]string {
+	filename := filepath.Base(dmt.FileName)
+	ext := filepath.Ext(filename)
+	host := ""
+	if u, err := url.Parse(dmt.OriginUrl); err == nil {
+		host = u.Host
+	}
+	return map[string]string{
+		"path":       dmt.FileName,
+		"dir":        filepath.Dir(dmt.FileName),
+		"filename":   filename,
+		"name":       strings.TrimSuffix(filename, ext),
+		"ext":        strings.TrimPrefix(ext, "."),
+		"origin_url": dmt.OriginUrl,
+		"link":       dmt.Link,
+		"host":       host,
+		"date":       time.Now().Format("2006-01-02"),
+	}
+}
@@ -0,0 +1,77 @@
+package postproc_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/postproc"
+	"video-downloader-go/internal/util/myfile"
+	"video-downloader-go/internal/util/mylog/dlbar"
+)
+
+func TestRunMoveAndExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 sh")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "测试.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	record := filepath.Join(dir, "record.txt")
+	config.G.PostProcessors = []config.PostProcessor{
+		{Use: config.PostProcessMove, Target: "{host}/{name}.{ext}"},
+		{Use: config.PostProcessExec, Command: []string{"sh", "-c", `echo "$VD_PATH" > "$0"`, record}},
+	}
+	defer func() { config.G.PostProcessors = nil }()
+
+	sub := filepath.Join(dir, "测试.zh.vtt")
+	if err := os.WriteFile(sub, []byte("subtitle"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dmt := meta.NewDownloadMeta("https://example.com/a.mp4", src, "https://www.example.com/play/1")
+	dmt.LogBar = dlbar.NewBar()
+	dmt.Subtitles = []string{sub}
+	if err := postproc.Run(dmt); err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(dir, "www.example.com", "测试.mp4")
+	if dmt.FileName != want {
+		t.Fatalf("期望文件被移动到 %s, 实际: %s", want, dmt.FileName)
+	}
+	wantSub := filepath.Join(dir, "www.example.com", "测试.zh.vtt")
+	if len(dmt.Subtitles) != 1 || dmt.Subtitles[0] != wantSub || !myfile.FileExist(wantSub) {
+		t.Fatalf("字幕文件没有跟随视频文件移动: %v", dmt.Subtitles)
+	}
+	content, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != want+"\n" {
+		t.Fatalf("exec 后处理器收到的路径异常: %s", content)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 false 命令")
+	}
+
+	config.G.PostProcessors = []config.PostProcessor{{Use: config.PostProcessExec, Command: []string{"false"}}}
+	defer func() { config.G.PostProcessors = nil }()
+
+	dmt := meta.NewDownloadMeta("https://example.com/a.mp4", filepath.Join(t.TempDir(), "a.mp4"), "")
+	dmt.LogBar = dlbar.NewBar()
+	if err := postproc.Run(dmt); err == nil {
+		t.Fatal("后处理失败时应返回错误")
+	}
+	if dmt.LogBar.Status != dlbar.BarStatusError {
+		t.Fatal("后处理失败时应更新任务条状态")
+	}
+}
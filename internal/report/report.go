@@ -0,0 +1,200 @@
+// 任务处理结果汇总, 在所有任务处理完成后输出
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"video-downloader-go/internal/constant"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/util/mylog/dlbar"
+	"video-downloader-go/internal/util/mystring"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/pkg/errors"
+)
+
+var (
+	DefaultJSONPath   = filepath.Join(constant.Dir_DataRoot, "report.json") // 汇总结果的默认存放路径
+	DefaultFailedPath = filepath.Join(constant.Dir_DataRoot, "failed.txt")  // 失败任务列表的默认存放路径
+)
+
+// Entry 一个任务的处理结果
+type Entry struct {
+	Name       string         `json:"name"`            // 任务名称
+	Url        string         `json:"url"`             // 源视频地址
+	State      meta.TaskState `json:"state"`           // 最终状态: done, failed
+	Path       string         `json:"path,omitempty"`  // 输出文件路径
+	Size       int64          `json:"size"`            // 文件大小, 单位: 字节
+	ElapsedSec float64        `json:"elapsed_sec"`     // 下载耗时, 单位: 秒
+	Speed      int64          `json:"speed"`           // 平均下载速度, 单位: 字节/秒
+	Tries      int            `json:"tries"`           // 失败的次数
+	Error      string         `json:"error,omitempty"` // 最后一次失败的原因
+
+	// 任务配置中的选项, 写入失败任务列表时原样保留
+	Priority int               `json:"priority,omitempty"` // 任务优先级
+	Headers  map[string]string `json:"headers,omitempty"`  // 任务指定的请求头
+}
+
+// FromVideo 根据解析失败的任务生成处理结果
+func FromVideo(vmt *meta.Video, err error) Entry {
+	e := Entry{Name: vmt.Name, Url: vmt.Url, State: meta.TaskFailed, Tries: vmt.Tries, Priority: vmt.Priority, Headers: vmt.Headers}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// FromDownload 根据处理结束的下载任务生成处理结果, err 不为空时表示任务失败
+func FromDownload(dmt *meta.Download, err error) Entry {
+	e := Entry{Name: dmt.Name, Url: dmt.OriginUrl, State: meta.TaskDone, Tries: dmt.Tries, Priority: dmt.Priority, Headers: dmt.Headers}
+	if err != nil {
+		e.State, e.Error = meta.TaskFailed, err.Error()
+		return e
+	}
+
+	e.Path = dmt.FileName
+	if stat, err := os.Stat(dmt.FileName); err == nil {
+		e.Size = stat.Size()
+	}
+	if !dmt.StartAt.IsZero() {
+		elapsed := time.Since(dmt.StartAt)
+		e.ElapsedSec = elapsed.Seconds()
+		if elapsed > 0 {
+			e.Speed = int64(float64(e.Size) / elapsed.Seconds())
+		}
+	}
+	return e
+}
+
+// Report 一次运行中所有任务的处理结果
+type Report struct {
+	mu      sync.Mutex
+	startAt time.Time
+	entries []Entry
+}
+
+// New 创建一个汇总对象, 开始计时
+func New() *Report {
+	return &Report{startAt: time.Now()}
+}
+
+// Add 添加一个任务的处理结果, 可以在多个协程中调用
+func (r *Report) Add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+// Entries 按照完成顺序返回所有任务的处理结果
+func (r *Report) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Failed 返回处理失败的任务
+func (r *Report) Failed() []Entry {
+	ans := []Entry{}
+	for _, e := range r.Entries() {
+		if e.State == meta.TaskFailed {
+			ans = append(ans, e)
+		}
+	}
+	return ans
+}
+
+// PrintTable 以表格的形式输出所有任务的处理结果
+func (r *Report) PrintTable(w io.Writer) {
+	hi := new(dlbar.HintItem)
+	rows := [][]string{{"状态", "名称", "大小", "耗时", "平均速度", "失败次数", "输出文件 / 失败原因"}}
+	for _, e := range r.Entries() {
+		speed := "-"
+		if e.ElapsedSec > 0 {
+			speed = hi.Size(e.Speed) + "/s"
+		}
+		row := []string{"成功", e.Name, hi.Size(e.Size), formatElapsed(e.ElapsedSec), speed, strconv.Itoa(e.Tries), e.Path}
+		if e.State == meta.TaskFailed {
+			row = []string{"失败", e.Name, "-", "-", "-", strconv.Itoa(e.Tries), e.Error}
+		}
+		rows = append(rows, row)
+	}
+
+	// 最后一列不需要对齐
+	widths := make([]int, len(rows[0])-1)
+	for _, row := range rows {
+		for i := range widths {
+			widths[i] = max(widths[i], runewidth.StringWidth(row[i]))
+		}
+	}
+	for _, row := range rows {
+		sb := strings.Builder{}
+		for i, col := range row {
+			if i < len(widths) {
+				sb.WriteString(mystring.PadRightByRuneWidth(col, widths[i], ' '))
+				sb.WriteString("  ")
+				continue
+			}
+			// 失败原因可能包含换行, 只保留第一行
+			sb.WriteString(strings.SplitN(col, "\n", 2)[0])
+		}
+		fmt.Fprintln(w, strings.TrimRight(sb.String(), " "))
+	}
+
+	failed := len(r.Failed())
+	fmt.Fprintf(w, "共 %d 个任务, 成功 %d 个, 失败 %d 个, 总耗时 %s\n",
+		len(rows)-1, len(rows)-1-failed, failed, time.Since(r.startAt).Round(time.Second))
+}
+
+// WriteJSON 将所有任务的处理结果以 JSON 的格式写入文件
+func (r *Report) WriteJSON(path string) error {
+	entries := r.Entries()
+	failed := len(r.Failed())
+	data, err := json.MarshalIndent(struct {
+		StartAt   time.Time `json:"start_at"`
+		EndAt     time.Time `json:"end_at"`
+		Total     int       `json:"total"`
+		Succeeded int       `json:"succeeded"`
+		Failed    int       `json:"failed"`
+		Tasks     []Entry   `json:"tasks"`
+	}{r.startAt, time.Now(), len(entries), len(entries) - failed, failed, entries}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "序列化处理结果失败")
+	}
+	return errors.Wrapf(os.WriteFile(path, data, 0644), "写入处理结果失败：%s", path)
+}
+
+// WriteFailed 将处理失败的任务以 data.txt 的格式写入文件, 可以直接作为下一次运行的输入
+//
+// 任务配置中的优先级和请求头等选项会一并写入
+// 没有失败的任务时删除旧的文件, 避免误用上一次运行的结果
+func (r *Report) WriteFailed(path string) error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "删除失败任务列表失败：%s", path)
+		}
+		return nil
+	}
+
+	sb := strings.Builder{}
+	for _, e := range failed {
+		tl := meta.TaskLine{Name: e.Name, Url: e.Url, Priority: e.Priority, Headers: e.Headers}
+		sb.WriteString(tl.String() + "\n")
+	}
+	return errors.Wrapf(os.WriteFile(path, []byte(sb.String()), 0644), "写入失败任务列表失败：%s", path)
+}
+
+// formatElapsed 将秒数格式化为易读的耗时
+func formatElapsed(sec float64) string {
+	if sec <= 0 {
+		return "-"
+	}
+	return (time.Duration(sec * float64(time.Second))).Round(time.Second).String()
+}
@@ -0,0 +1,102 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/report"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "第一集.mp4")
+	os.WriteFile(output, make([]byte, 2048), 0644)
+
+	rp := report.New()
+	dmt := meta.NewDownloadMeta("https://cdn.example.com/1.mp4", "第一集", "https://example.com/1")
+	dmt.FileName, dmt.StartAt = output, time.Now().Add(-2*time.Second)
+	rp.Add(report.FromDownload(dmt, nil))
+
+	dmt = meta.NewDownloadMeta("https://cdn.example.com/2.mp4", "第二集", "https://example.com/2")
+	dmt.Tries = 5
+	rp.Add(report.FromDownload(dmt, errors.New("连接超时")))
+	rp.Add(report.FromVideo(&meta.Video{Name: "第三集", Url: "https://example.com/3"}, errors.New("解析失败")))
+
+	entries := rp.Entries()
+	if entries[0].Size != 2048 || entries[0].Speed <= 0 || entries[0].Path != output {
+		t.Fatalf("成功任务的结果异常: %+v", entries[0])
+	}
+
+	buf := bytes.Buffer{}
+	rp.PrintTable(&buf)
+	if !strings.Contains(buf.String(), "成功 1 个, 失败 2 个") || !strings.Contains(buf.String(), "连接超时") {
+		t.Fatalf("表格输出异常:\n%s", buf.String())
+	}
+
+	jsonPath, failedPath := filepath.Join(dir, "report.json"), filepath.Join(dir, "failed.txt")
+	if err := rp.WriteJSON(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Failed int            `json:"failed"`
+		Tasks  []report.Entry `json:"tasks"`
+	}
+	data, _ := os.ReadFile(jsonPath)
+	if err := json.Unmarshal(data, &parsed); err != nil || parsed.Failed != 2 || len(parsed.Tasks) != 3 {
+		t.Fatalf("JSON 输出异常: %s", data)
+	}
+
+	if err := rp.WriteFailed(failedPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(failedPath)
+	if string(data) != "第二集|https://example.com/2\n第三集|https://example.com/3\n" {
+		t.Fatalf("失败任务列表异常: %s", data)
+	}
+
+	// 没有失败的任务时删除旧的列表
+	if err := report.New().WriteFailed(failedPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(failedPath); !os.IsNotExist(err) {
+		t.Fatal("没有失败的任务时应该删除旧的失败任务列表")
+	}
+}
+
+func TestWriteFailedOptions(t *testing.T) {
+	line := "第一集|https://example.com/1|priority=5|header=Referer: https://example.com/|header=User-Agent: Mozilla/5.0"
+	tl, err := meta.ParseTaskLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rp := report.New()
+	vmt := &meta.Video{Name: tl.Name, Url: tl.Url, Priority: tl.Priority, Headers: tl.Headers}
+	rp.Add(report.FromVideo(vmt, errors.New("解析失败")))
+	dmt := meta.NewDownloadMeta("https://cdn.example.com/2.mp4", "第二集", "https://example.com/2")
+	dmt.Priority = -1
+	dmt.SetHeaders(map[string]string{"Cookie": "a=1"})
+	rp.Add(report.FromDownload(dmt, errors.New("连接超时")))
+
+	failedPath := filepath.Join(t.TempDir(), "failed.txt")
+	if err = rp.WriteFailed(failedPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(failedPath)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[0] != line {
+		t.Fatalf("失败任务列表没有保留任务选项: %s", data)
+	}
+
+	// 写入的内容可以重新解析为相同的任务配置
+	got, err := meta.ParseTaskLine(lines[1])
+	if err != nil || got.Priority != -1 || got.Headers["Cookie"] != "a=1" {
+		t.Fatalf("重新解析失败任务异常: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,110 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/util/mylog/dlbar"
+
+	"github.com/pkg/errors"
+)
+
+// containerCodecs 记录每种容器能够直接容纳的视频和音频编码, 值为 nil 时表示不限制
+//
+// 这里只列出播放器普遍支持的组合, 如 VP9 / Opus 虽然能写入 mp4, 但兼容性较差, 交给 mkv 处理
+var containerCodecs = map[string]map[string][]string{
+	config.ContainerMP4: {
+		ffmpeg.StreamVideo: {"h264", "hevc", "av1", "mpeg4"},
+		ffmpeg.StreamAudio: {"aac", "mp3", "ac3", "eac3", "alac", "flac"},
+	},
+	config.ContainerM4A: {
+		ffmpeg.StreamVideo: {},
+		ffmpeg.StreamAudio: {"aac", "alac"},
+	},
+	config.ContainerTS: {
+		ffmpeg.StreamVideo: {"h264", "hevc", "mpeg2video"},
+		ffmpeg.StreamAudio: {"aac", "mp3", "ac3", "eac3"},
+	},
+	config.ContainerMKV: nil,
+}
+
+// containerFormats 记录 ffmpeg 识别出的封装格式中, 与容器对应的名称
+var containerFormats = map[string]string{
+	config.ContainerMP4: "mp4",
+	config.ContainerM4A: "m4a",
+	config.ContainerTS:  "mpegts",
+	config.ContainerMKV: "matroska",
+}
+
+// ContainerFits 判断容器能否直接容纳所有的视频流和音频流
+func ContainerFits(container string, streams []ffmpeg.Stream) bool {
+	codecs, ok := containerCodecs[container]
+	if !ok {
+		return false
+	}
+	if codecs == nil {
+		return true
+	}
+	for _, s := range streams {
+		valid, ok := codecs[s.Type]
+		if !ok {
+			// 字幕等其他流不影响容器的选择
+			continue
+		}
+		if !slices.Contains(valid, s.Codec) {
+			return false
+		}
+	}
+	return true
+}
+
+// FitContainer 返回能够容纳所有流的容器, 优先使用 preferred, 其次是 mp4, 最后是 mkv
+func FitContainer(preferred string, streams []ffmpeg.Stream) string {
+	for _, c := range []string{preferred, config.ContainerMP4} {
+		if ContainerFits(c, streams) {
+			return c
+		}
+	}
+	return config.ContainerMKV
+}
+
+// FormatMatches 判断 ffmpeg 识别出的封装格式是否就是目标容器
+func FormatMatches(container, format string) bool {
+	name, ok := containerFormats[container]
+	return ok && slices.Contains(strings.Split(format, ","), name)
+}
+
+// ContainerOf 返回文件路径对应的容器, 即不带 . 的小写后缀
+func ContainerOf(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ReplaceContainer 将文件路径的后缀替换为指定容器
+func ReplaceContainer(path, container string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + container
+}
+
+// Remux 调用 ffmpeg 以 copy 的方式将 src 重新封装为 dst, 成功后删除 src
+//
+// src 与 dst 相同时, 先输出到临时文件再覆盖
+func Remux(src, dst string, duration time.Duration, bar *dlbar.Bar) error {
+	out := dst
+	if out == src {
+		dir, base := filepath.Split(dst)
+		out = filepath.Join(dir, "remux_"+base)
+	}
+
+	cmd := ffmpeg.Command("-y", "-i", src, "-map", "0:v?", "-map", "0:a?", "-c", "copy", out)
+	if err := ffmpeg.RunWithProgress(cmd, duration, ProgressHint(bar, "正在转换容器")); err != nil {
+		os.Remove(out)
+		return errors.Wrapf(err, "转换容器失败: %s", dst)
+	}
+	if out != dst {
+		return errors.Wrapf(os.Rename(out, dst), "覆盖原文件失败: %s", dst)
+	}
+	return errors.Wrapf(os.Remove(src), "删除原文件失败: %s", src)
+}
@@ -0,0 +1,42 @@
+package transfer_test
+
+import (
+	"testing"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/transfer"
+)
+
+func TestFitContainer(t *testing.T) {
+	h264Aac := []ffmpeg.Stream{{Type: ffmpeg.StreamVideo, Codec: "h264"}, {Type: ffmpeg.StreamAudio, Codec: "aac"}}
+	vp9Opus := []ffmpeg.Stream{{Type: ffmpeg.StreamVideo, Codec: "vp9"}, {Type: ffmpeg.StreamAudio, Codec: "opus"}}
+
+	cases := []struct {
+		preferred string
+		streams   []ffmpeg.Stream
+		want      string
+	}{
+		{config.ContainerMP4, h264Aac, config.ContainerMP4},
+		{config.ContainerTS, h264Aac, config.ContainerTS},
+		{config.ContainerMP4, vp9Opus, config.ContainerMKV},
+		{config.ContainerM4A, h264Aac, config.ContainerMP4},
+		{config.ContainerM4A, h264Aac[1:], config.ContainerM4A},
+	}
+	for _, c := range cases {
+		if got := transfer.FitContainer(c.preferred, c.streams); got != c.want {
+			t.Errorf("preferred: %s, streams: %v, 期望: %s, 实际: %s", c.preferred, c.streams, c.want, got)
+		}
+	}
+}
+
+func TestFormatMatches(t *testing.T) {
+	if !transfer.FormatMatches(config.ContainerMP4, "mov,mp4,m4a,3gp,3g2,mj2") {
+		t.Error("mp4 应该匹配")
+	}
+	if transfer.FormatMatches(config.ContainerMKV, "mov,mp4,m4a,3gp,3g2,mj2") {
+		t.Error("mkv 不应该匹配 mp4 格式")
+	}
+	if got := transfer.ReplaceContainer("/a/第1集.mp4.bak.mp4", config.ContainerMKV); got != "/a/第1集.mp4.bak.mkv" {
+		t.Errorf("替换后缀异常: %s", got)
+	}
+}
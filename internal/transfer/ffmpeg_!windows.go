@@ -9,13 +9,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/util/mylog/dlbar"
 )
 
 // 核心的合并 ts 文件逻辑
-func ConcatFilesByStrV2(tsDir string, tsFilePaths []string, outputPath string, bar *dlbar.Bar) error {
-	bar.TransferHint("正在合并切片 (0%)")
+func ConcatFilesByStrV2(tsDir string, tsFilePaths []string, outputPath string, duration time.Duration, bar *dlbar.Bar) error {
+	hint := ProgressHint(bar, "正在合并切片")
+	hint(0, -1, 0)
 
 	// 1 准备 shell 脚本命令
 	shellBuilder := strings.Builder{}
@@ -24,10 +27,9 @@ func ConcatFilesByStrV2(tsDir string, tsFilePaths []string, outputPath string, b
 	shellBuilder.WriteString("\n")
 	shellBuilder.WriteString(`cd "$SCRIPT_DIR"`)
 	shellBuilder.WriteString("\n")
-	bar.TransferHint("正在合并切片 (25%)")
 
 	concatPlaceholder := "{{concat}}"
-	ffmpegCmd := fmt.Sprintf(`"%s" -i "concat:%s" -c copy "%s"`, config.FfmpegPath, concatPlaceholder, outputPath)
+	ffmpegCmd := fmt.Sprintf(`"%s" %s -i "concat:%s" -c copy "%s"`, config.FfmpegPath, strings.Join(ffmpeg.ProgressArgs(), " "), concatPlaceholder, outputPath)
 	concatBuilder := strings.Builder{}
 	for idx, tsPath := range tsFilePaths {
 		if idx != 0 {
@@ -38,7 +40,6 @@ func ConcatFilesByStrV2(tsDir string, tsFilePaths []string, outputPath string, b
 	ffmpegCmd = strings.Replace(ffmpegCmd, concatPlaceholder, concatBuilder.String(), -1)
 	shellBuilder.WriteString(ffmpegCmd)
 	shellBuilder.WriteString("\n")
-	bar.TransferHint("正在合并切片 (50%)")
 
 	// 2 将命令写入文件 merge.sh 中
 	mergeScriptName := filepath.Join(tsDir, "merge.sh")
@@ -46,14 +47,11 @@ func ConcatFilesByStrV2(tsDir string, tsFilePaths []string, outputPath string, b
 		return fmt.Errorf("写入 merge 脚本失败: %v, path: %s", err, mergeScriptName)
 	}
 	defer os.Remove(mergeScriptName)
-	bar.TransferHint("正在合并切片 (75%)")
 
-	// 3 执行脚本进行合并
+	// 3 执行脚本进行合并, ffmpeg 的进度信息会经由脚本的标准输出返回
 	cmd := exec.Command(mergeScriptName)
-	if _, err := cmd.CombinedOutput(); err != nil {
+	if err := ffmpeg.RunWithProgress(cmd, duration, hint); err != nil {
 		return fmt.Errorf("执行脚本失败: %v, script: %s", err, shellBuilder.String())
 	}
-	bar.TransferHint("正在合并切片 (100%)")
-
 	return nil
 }
@@ -2,16 +2,14 @@ package transfer
 
 import (
 	"fmt"
-	"io/fs"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"sort"
-	"strconv"
 	"strings"
+	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/util/myfile"
 	"video-downloader-go/internal/util/mylog"
 	"video-downloader-go/internal/util/mylog/dlbar"
@@ -21,51 +19,27 @@ import (
 )
 
 // concatFileFunc 合并文件函数
-type concatFileFunc func(tsDir string, tsFilePaths []string, outputPath string, bar *dlbar.Bar) error
+type concatFileFunc func(tsDir string, tsFilePaths []string, outputPath string, duration time.Duration, bar *dlbar.Bar) error
 
 type ffmpegTransfer struct {
 	concatFileFunc concatFileFunc
 }
 
-func (ft *ffmpegTransfer) Ts2Mp4(tsDir, outputPath string, bar *dlbar.Bar) error {
+func (ft *ffmpegTransfer) Ts2Mp4(tsDir string, segments []Segment, outputPath string, bar *dlbar.Bar) error {
 	fi, err := os.Stat(tsDir)
 	if err != nil || !fi.IsDir() {
 		return errors.New("无效的 ts 目录")
 	}
-	// 1 读取文件并排序
-	tsFilePaths := []string{}
-	err = filepath.Walk(tsDir, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return errors.Wrap(err, "遍历目录文件失败")
-		}
-		if info.IsDir() {
-			return nil
-		}
-		tsFilePaths = append(tsFilePaths, path)
-		return nil
-	})
+	// 1 校验分片完整性, 并按序号排序
+	segments, err = CheckSegments(segments, FirstSegmentIndex)
 	if err != nil {
-		return errors.Wrap(err, "读取文件时出错")
+		return errors.Wrap(err, "校验分片失败")
 	}
-	regex, err := regexp.Compile(config.G.Transfer.TsFilenameRegex)
-	if err != nil {
-		return errors.Wrap(err, "正则表达式编译错误")
-	}
-	sort.Slice(tsFilePaths, func(i, j int) bool {
-		bi, bj := filepath.Base(tsFilePaths[i]), filepath.Base(tsFilePaths[j])
-		mi, mj := regex.FindStringSubmatch(bi), regex.FindStringSubmatch(bj)
-		if len(mi) == 0 || len(mj) == 0 {
-			err = errors.New("ts 文件名不规范")
-			return false
-		}
-		in, _ := strconv.Atoi(mi[1])
-		jn, _ := strconv.Atoi(mj[1])
-		return in < jn
-	})
-	if err != nil {
-		return errors.Wrap(err, "排序文件失败")
+	tsFilePaths := make([]string, len(segments))
+	for i, seg := range segments {
+		tsFilePaths[i] = seg.Path
 	}
-	err = ft.concatFileFunc(tsDir, tsFilePaths, outputPath, bar)
+	err = ft.concatFileFunc(tsDir, tsFilePaths, outputPath, TotalDuration(segments), bar)
 	if err != nil {
 		return errors.Wrap(err, "合并 ts 文件时出现错误")
 	}
@@ -73,8 +47,9 @@ func (ft *ffmpegTransfer) Ts2Mp4(tsDir, outputPath string, bar *dlbar.Bar) error
 }
 
 // ConcatFilesByTxt 先将 ts 切片编排到 txt 文件中, 再调用 ffmpeg 一次性合并
-func ConcatFilesByTxt(tsDir string, tsFilePaths []string, outputPath string, bar *dlbar.Bar) error {
-	bar.TransferHint("正在合并切片文件 (0%)")
+func ConcatFilesByTxt(tsDir string, tsFilePaths []string, outputPath string, duration time.Duration, bar *dlbar.Bar) error {
+	hint := ProgressHint(bar, "正在合并切片文件")
+	hint(0, -1, 0)
 
 	// 1 将切片信息写入 tsDir
 	filelistContent := strings.Builder{}
@@ -89,21 +64,19 @@ func ConcatFilesByTxt(tsDir string, tsFilePaths []string, outputPath string, bar
 	if err := os.WriteFile(filelistPath, []byte(filelistContent.String()), os.ModePerm); err != nil {
 		return fmt.Errorf("写入切片编排信息失败: %v", err)
 	}
-	bar.TransferHint("正在合并切片文件 (50%)")
 
-	// 2 调用 ffmpeg 进行合并
-	cmd := exec.Command(config.FfmpegPath, "-f", "concat", "-safe", "0", "-i", filelistPath, "-c", "copy", outputPath)
-	if err := executeCmd(cmd); err != nil {
+	// 2 调用 ffmpeg 进行合并, 实时读取合并进度
+	cmd := ffmpeg.Command("-f", "concat", "-safe", "0", "-i", filelistPath, "-c", "copy", outputPath)
+	if err := ffmpeg.RunWithProgress(cmd, duration, hint); err != nil {
 		return fmt.Errorf("调用 ffmpeg 出现异常: %v", err)
 	}
-	bar.TransferHint("正在合并切片文件 (100%)")
 	return nil
 }
 
 // 核心的合并 ts 文件逻辑
-func ConcatFilesByStr(tsDir string, tsFilePaths []string, outputPath string, bar *dlbar.Bar) error {
+func ConcatFilesByStr(tsDir string, tsFilePaths []string, outputPath string, duration time.Duration, bar *dlbar.Bar) error {
 	tempTsFilePath := fmt.Sprintf("%s/ts_%d.ts", tsDir, math.MaxInt32)
-	tempDestFilePath := strings.Replace(outputPath, ".mp4", ".ts", -1)
+	tempDestFilePath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "_concat.ts"
 	if e, d := myfile.DeleteFileIfExist(tempTsFilePath); e && !d {
 		return errors.New("无法删除临时文件：" + tempTsFilePath)
 	}
@@ -111,6 +84,8 @@ func ConcatFilesByStr(tsDir string, tsFilePaths []string, outputPath string, bar
 		return errors.New("无法删除临时文件：" + tempDestFilePath)
 	}
 	// 遍历列表合成
+	hint := ProgressHint(bar, "正在合并分片")
+	start := time.Now()
 	size, current := len(tsFilePaths), 0
 	for current < size {
 		// 一次性合并 50 个分片
@@ -147,15 +122,16 @@ func ConcatFilesByStr(tsDir string, tsFilePaths []string, outputPath string, bar
 				return errors.Wrap(err, "临时文件拷贝异常："+tempDestFilePath)
 			}
 		}
-		percent := int(math.Round(float64(current) / float64(size) * 100))
-		bar.TransferHint(fmt.Sprintf("正在合并分片(%d%%)", percent))
+		// 按照已合并的分片数估算进度和剩余时间
+		percent, eta := ffmpeg.CalcProgress(time.Duration(current), time.Duration(size), time.Since(start))
+		hint(percent, eta, 0)
 	}
 	// 全部转换完成后，生成最终文件
 	if !myfile.FileExist(tempTsFilePath) {
 		return errors.New("检测不到最终的 ts 文件")
 	}
-	cmd := exec.Command(config.FfmpegPath, "-i", "concat:"+tempTsFilePath, "-c", "copy", outputPath)
-	if err := executeCmd(cmd); err != nil {
+	cmd := ffmpeg.Command("-i", "concat:"+tempTsFilePath, "-c", "copy", outputPath)
+	if err := ffmpeg.RunWithProgress(cmd, duration, ProgressHint(bar, "正在生成视频文件")); err != nil {
 		return errors.Wrap(err, "合并最终视频文件失败")
 	}
 	if e, d := myfile.DeleteFileIfExist(tempTsFilePath); e && !d {
@@ -164,11 +140,11 @@ func ConcatFilesByStr(tsDir string, tsFilePaths []string, outputPath string, bar
 	return nil
 }
 
-// 执行命令行命令
+// 执行命令行命令, 失败时将命令输出附带在错误信息中
 func executeCmd(cmd *exec.Cmd) error {
-	_, err := cmd.CombinedOutput()
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return errors.Wrap(err, "执行命令时出错")
+		return errors.Wrapf(err, "执行命令时出错, output: %s", strings.TrimSpace(string(output)))
 	}
 	return nil
 }
@@ -0,0 +1,88 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Segment 是一个已下载到本地的 ts 分片, 由下载器按照 m3u8 中的顺序提供
+type Segment struct {
+	Index    int           // 分片在 m3u8 中的序号
+	Path     string        // 分片文件的绝对路径
+	Duration time.Duration // 分片时长, 未知时为 0
+}
+
+// MissingSegmentsError 合并前校验分片时发现有分片缺失或为空
+type MissingSegmentsError struct {
+	Missing []int // 缺失的分片序号
+	Empty   []int // 文件大小为 0 的分片序号
+}
+
+func (e *MissingSegmentsError) Error() string {
+	msgs := []string{}
+	if len(e.Missing) > 0 {
+		msgs = append(msgs, fmt.Sprintf("缺失分片: %v", e.Missing))
+	}
+	if len(e.Empty) > 0 {
+		msgs = append(msgs, fmt.Sprintf("空分片: %v", e.Empty))
+	}
+	return "分片不完整, " + strings.Join(msgs, ", ")
+}
+
+// FirstSegmentIndex 是 m3u8 中第一个分片的序号, 解析 m3u8 时分片序号从 1 开始
+const FirstSegmentIndex = 1
+
+// CheckSegments 对分片按序号排序, 并校验序号是否从 first 开始连续、每个分片文件是否存在且非空
+//
+// 校验不通过时返回 *MissingSegmentsError
+func CheckSegments(segments []Segment, first int) ([]Segment, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("分片列表为空")
+	}
+	sorted := make([]Segment, len(segments))
+	copy(sorted, segments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+
+	mse := &MissingSegmentsError{}
+	expect := first
+	for i, seg := range sorted {
+		if i > 0 && seg.Index == sorted[i-1].Index {
+			return nil, fmt.Errorf("分片序号重复: %d", seg.Index)
+		}
+		// 序号跳跃说明下载器提供的列表本身就不完整
+		for ; expect < seg.Index; expect++ {
+			mse.Missing = append(mse.Missing, expect)
+		}
+		expect = seg.Index + 1
+
+		stat, err := os.Stat(seg.Path)
+		if err != nil || stat.IsDir() {
+			mse.Missing = append(mse.Missing, seg.Index)
+			continue
+		}
+		if stat.Size() == 0 {
+			mse.Empty = append(mse.Empty, seg.Index)
+		}
+	}
+
+	if len(mse.Missing) > 0 || len(mse.Empty) > 0 {
+		return nil, mse
+	}
+	return sorted, nil
+}
+
+// TotalDuration 累加所有分片的时长, 作为合并后视频的预期总时长
+func TotalDuration(segments []Segment) time.Duration {
+	var total time.Duration
+	for _, seg := range segments {
+		total += seg.Duration
+	}
+	return total
+}
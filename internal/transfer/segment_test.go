@@ -0,0 +1,52 @@
+package transfer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"video-downloader-go/internal/transfer"
+)
+
+func TestCheckSegments(t *testing.T) {
+	newSegment := func(index int, content string) transfer.Segment {
+		path := filepath.Join(t.TempDir(), "ts.ts")
+		if content != "-" {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return transfer.Segment{Index: index, Path: path}
+	}
+
+	// 乱序传入时按序号排序
+	segments, err := transfer.CheckSegments([]transfer.Segment{newSegment(2, "b"), newSegment(1, "a"), newSegment(3, "c")}, transfer.FirstSegmentIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, seg := range segments {
+		if seg.Index != i+1 {
+			t.Fatalf("排序异常: %v", segments)
+		}
+	}
+
+	// 文件缺失、文件为空、序号跳跃
+	_, err = transfer.CheckSegments([]transfer.Segment{newSegment(1, "a"), newSegment(2, "-"), newSegment(3, ""), newSegment(5, "e")}, transfer.FirstSegmentIndex)
+	var mse *transfer.MissingSegmentsError
+	if !errors.As(err, &mse) {
+		t.Fatalf("期望返回分片缺失错误, 实际: %v", err)
+	}
+	if !reflect.DeepEqual(mse.Missing, []int{2, 4}) || !reflect.DeepEqual(mse.Empty, []int{3}) {
+		t.Fatalf("missing: %v, empty: %v", mse.Missing, mse.Empty)
+	}
+
+	// 开头的分片缺失
+	_, err = transfer.CheckSegments([]transfer.Segment{newSegment(3, "c"), newSegment(4, "d")}, transfer.FirstSegmentIndex)
+	if !errors.As(err, &mse) {
+		t.Fatalf("期望返回分片缺失错误, 实际: %v", err)
+	}
+	if !reflect.DeepEqual(mse.Missing, []int{1, 2}) || len(mse.Empty) > 0 {
+		t.Fatalf("missing: %v, empty: %v", mse.Missing, mse.Empty)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"testing"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/transfer"
 )
 
@@ -41,7 +42,7 @@ func TestFfmpegTransfer(t *testing.T) {
 		return
 	}
 	ft := transfer.Instance("")
-	err = ft.Ts2Mp4("/Users/ambitious/Downloads/测试.mp4_temp_ts_files", "/Users/ambitious/Downloads/测试.mp4", nil)
+	err = ft.Ts2Mp4("/Users/ambitious/Downloads/测试.mp4_temp_ts_files", nil, "/Users/ambitious/Downloads/测试.mp4", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -1,12 +1,15 @@
 package transfer
 
-import "video-downloader-go/internal/util/mylog/dlbar"
+import (
+	"video-downloader-go/internal/util/mylog/dlbar"
+)
 
 // ts 文件转换器接口
 type TsTransfer interface {
-	// 将 ts 格式的文件列表转换成 mp4 格式的视频文件
+	// 将 ts 格式的文件列表转换成视频文件, 输出的容器由 outputPath 的后缀决定
 	// @param tsDir 存放 ts 文件的目录
+	// @param segments 下载器提供的分片列表, 合并前会校验其完整性
 	// @param outputPath 合并后输出的文件绝对地址
 	// @param bar 任务日志
-	Ts2Mp4(tsDir, outputPath string, bar *dlbar.Bar) error
+	Ts2Mp4(tsDir string, segments []Segment, outputPath string, bar *dlbar.Bar) error
 }
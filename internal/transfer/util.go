@@ -1,7 +1,11 @@
 package transfer
 
 import (
+	"fmt"
+	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
+	"video-downloader-go/internal/util/mylog/dlbar"
 )
 
 // 获取 ts 转换器实例
@@ -19,3 +23,36 @@ func Instance(originUrl string) TsTransfer {
 		panic("没有初始化 ts 转换器类型")
 	}
 }
+
+// ProgressHint 返回一个 ffmpeg 进度处理函数, 将真实的处理进度和剩余时间更新到任务条上
+//
+// bar 为空时不做任何处理
+func ProgressHint(bar *dlbar.Bar, title string) ffmpeg.ProgressHandler {
+	return func(percent int, eta, processed time.Duration) {
+		if bar == nil {
+			return
+		}
+		if percent < 0 {
+			bar.TransferHint(fmt.Sprintf("%s (已处理 %s)", title, FormatClock(processed)))
+			return
+		}
+		if eta < 0 {
+			bar.TransferHint(fmt.Sprintf("%s (%d%%)", title, percent))
+			return
+		}
+		bar.TransferHint(fmt.Sprintf("%s (%d%%, 剩余 %s)", title, percent, FormatClock(eta)))
+	}
+}
+
+// FormatClock 将时长格式化为 mm:ss 或 hh:mm:ss
+func FormatClock(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	sec := int64(d.Round(time.Second) / time.Second)
+	h, m, s := sec/3600, sec%3600/60, sec%60
+	if h > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
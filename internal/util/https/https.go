@@ -8,12 +8,16 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
 
 var client *http.Client
 
+// proxy 请求使用的代理, 为空时不使用代理
+var proxy func(*http.Request) (*url.URL, error)
+
 // RedirectCodes 有重定向含义的 http 响应码
 var RedirectCodes = [4]int{http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
 
@@ -21,6 +25,12 @@ func init() {
 	client = &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				if proxy == nil {
+					return nil, nil
+				}
+				return proxy(req)
+			},
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
@@ -28,6 +38,11 @@ func init() {
 	}
 }
 
+// SetProxy 设置请求使用的代理, 需要在发出请求之前调用
+func SetProxy(p func(*http.Request) (*url.URL, error)) {
+	proxy = p
+}
+
 // IsSuccessCode 判断 http code 是否为成功状态
 func IsSuccessCode(code int) bool {
 	codeStr := strconv.Itoa(code)
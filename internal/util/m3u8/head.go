@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 	"video-downloader-go/internal/util/mylog"
 )
 
@@ -15,6 +17,7 @@ const (
 
 const (
 	ExtXMap = "#EXT-X-MAP:"
+	ExtInf  = "#EXTINF:"
 )
 
 // HeadInfo 存放从 m3u8 文件中解析出来的视频头部信息
@@ -65,3 +68,17 @@ func ResolveXMap(line string) (*HeadInfo, error) {
 	mylog.Infof("EXT-X-MAP 解析结果: %v", headInfo)
 	return headInfo, nil
 }
+
+// ResolveExtInf 解析 #EXTINF 标签中的分片时长
+func ResolveExtInf(line string) (time.Duration, bool) {
+	if !strings.HasPrefix(line, ExtInf) {
+		return 0, false
+	}
+	line = strings.TrimPrefix(line, ExtInf)
+	line, _, _ = strings.Cut(line, ",")
+	sec, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec * float64(time.Second)), true
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/lib/ffmpeg"
 	"video-downloader-go/internal/meta"
 	"video-downloader-go/internal/transfer"
 	"video-downloader-go/internal/util"
@@ -38,6 +39,18 @@ var ValidM3U8ContentTypes = map[string]struct{}{
 // @param headers 附加的请求头
 // @return 是否是一个有效的 m3u8 地址
 func CheckM3U8(url string, headers map[string]string) bool {
+	return CheckM3U8WithClient(url, headers, nil)
+}
+
+// 检查一个 url 是否是 m3u8 地址，并使用任务的客户端发送请求
+// @param url 要检查的地址
+// @param headers 附加的请求头
+// @param client 发送请求的客户端，为空时使用 TimeoutHttpClient
+// @return 是否是一个有效的 m3u8 地址
+func CheckM3U8WithClient(url string, headers map[string]string, client *http.Client) bool {
+	if client == nil {
+		client = myhttp.TimeoutHttpClient()
+	}
 	if len(url) == 0 {
 		return false
 	}
@@ -52,15 +65,13 @@ func CheckM3U8(url string, headers map[string]string) bool {
 		for k, v := range headers {
 			request.Header.Set(k, v)
 		}
-		request.Header.Set("Connection", "Close")
-		// 创建客户端，发送请求
-		client := myhttp.TimeoutHttpClient()
+		// 发送请求
 		resp, err := client.Do(request)
 		if err != nil {
 			util.PrintRetryError("发送请求异常", err, 2)
 			continue
 		}
-		defer resp.Body.Close()
+		defer myhttp.DrainBody(resp.Body)
 		if resp.StatusCode != http.StatusOK {
 			util.PrintRetryError("请求响应异常", err, 2)
 			continue
@@ -81,8 +92,20 @@ func CheckM3U8(url string, headers map[string]string) bool {
 // @param headers 请求头，可以为空
 // @return ts 文件列表
 func ReadTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error) {
+	return ReadTsUrlsWithClient(m3u8Url, headers, nil)
+}
+
+// 读取 M3U8 文件中的 ts 文件列表，并使用任务的客户端发送请求
+// @param m3u8url m3u8 文件的下载地址
+// @param headers 请求头，可以为空
+// @param client 发送请求的客户端，为空时使用 TimeoutHttpClient，客户端带有 cookie jar 时，播放列表响应中的 Set-Cookie 会对分片请求生效
+// @return ts 文件列表
+func ReadTsUrlsWithClient(m3u8Url string, headers map[string]string, client *http.Client) ([]*TsMeta, error) {
+	if client == nil {
+		client = myhttp.TimeoutHttpClient()
+	}
 	if strings.HasPrefix(m3u8Url, NetworkLinkPrefix) {
-		return readHttpTsUrls(m3u8Url, headers)
+		return readHttpTsUrls(m3u8Url, headers, client)
 	}
 	prefix := LocalFilePrefix + "://"
 	if !strings.HasPrefix(m3u8Url, LocalFilePrefix) {
@@ -103,9 +126,15 @@ func ReadTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error) {
 	}
 	defer mFile.Close()
 	ans := []*TsMeta{}
+	var extInf time.Duration
 	scanner := bufio.NewScanner(mFile)
 	for scanner.Scan() {
 		line := scanner.Text()
+		if d, ok := ResolveExtInf(line); ok {
+			// 记录分片时长, 作用于下一个分片
+			extInf = d
+			continue
+		}
 		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
 			// 去除掉注释和空行
 			continue
@@ -114,7 +143,8 @@ func ReadTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error) {
 			return nil, errors.New("m3u8 文件不规范：检测不到 http 协议")
 		}
 		// 2 封装对象
-		ans = append(ans, &TsMeta{Url: line, Index: len(ans) + 1})
+		ans = append(ans, &TsMeta{Url: line, Index: len(ans) + 1, Duration: extInf})
+		extInf = 0
 	}
 	if scanner.Err() != nil {
 		return nil, fmt.Errorf("扫描文件出错: %v", scanner.Err())
@@ -131,9 +161,10 @@ func ReadTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error) {
 // 读取网络 M3U8 文件
 // @param m3u8Url url
 // @param headers 请求头
+// @param client 发送请求的客户端
 // @return ts urls
-func readHttpTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error) {
-	if !CheckM3U8(m3u8Url, headers) {
+func readHttpTsUrls(m3u8Url string, headers map[string]string, client *http.Client) ([]*TsMeta, error) {
+	if !CheckM3U8WithClient(m3u8Url, headers, client) {
 		return nil, errors.New("不是规范的 m3u8 地址")
 	}
 
@@ -151,7 +182,6 @@ func readHttpTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error
 	baseUrl := m3u8Url[:lastSepPos]
 
 	// 3 读取 m3u8 信息
-	client := myhttp.TimeoutHttpClient()
 	for {
 		req, err := http.NewRequest(http.MethodGet, m3u8Url, nil)
 		if err != nil {
@@ -176,11 +206,18 @@ func readHttpTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error
 		// 逐行扫描 m3u8 文件，将 ts 分片封装成 meta 对象
 		scanner := bufio.NewScanner(resp.Body)
 		ans := []*TsMeta{}
+		var extInf time.Duration
 		// xMapUrl := ""
 		for scanner.Scan() {
 			mt := TsMeta{Index: len(ans) + 1}
 			line := scanner.Text()
 
+			// 记录分片时长, 作用于下一个分片
+			if d, ok := ResolveExtInf(line); ok {
+				extInf = d
+				continue
+			}
+
 			// 判断是否是 X-MAP Head 头
 			if strings.HasPrefix(line, ExtXMap) {
 				if hi, err := ResolveXMap(line); err == nil && hi.Uri != "" {
@@ -202,6 +239,7 @@ func readHttpTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error
 			}
 			// mt.HeadUrl = xMapUrl
 			mt.Url = line
+			mt.Duration, extInf = extInf, 0
 
 			ans = append(ans, &mt)
 		}
@@ -216,18 +254,34 @@ func readHttpTsUrls(m3u8Url string, headers map[string]string) ([]*TsMeta, error
 
 // 合并 ts 文件列表
 // @param tsDirPath 临时目录
-func Merge(tsDirPath string, dmt *meta.Download) error {
+// @param segments  下载器提供的分片列表
+func Merge(tsDirPath string, segments []transfer.Segment, dmt *meta.Download) error {
 	if dmt == nil {
 		return errors.New("下载元数据为空")
 	}
 
 	dirName := filepath.Base(tsDirPath)
-	fileName := dirName[:len(dirName)-len(config.G.Downloader.TsDirSuffix)-1]
-	mylog.Infof("准备将 ts 文件合并成 mp4 文件，目标视频：%s", fileName)
-	err := transfer.Instance(dmt.OriginUrl).Ts2Mp4(tsDirPath, filepath.Join(filepath.Dir(tsDirPath), fileName), dmt.LogBar)
+	fileName := dirName[:len(dirName)-len(config.G.Downloader.CustomTsDirSuffix(dmt.OriginUrl))-1]
+	outputPath := filepath.Join(filepath.Dir(tsDirPath), fileName)
+
+	// 根据分片的编码检查目标容器能否容纳, 不能容纳时自动更换
+	if len(segments) > 0 {
+		if pr, err := ffmpeg.Probe(segments[0].Path); err == nil {
+			want := transfer.ContainerOf(outputPath)
+			if fit := transfer.FitContainer(want, pr.Streams); fit != want {
+				mylog.Warnf("分片的编码无法直接放入 %s 容器, 自动更换为 %s, 目标视频：%s", want, fit, fileName)
+				outputPath = transfer.ReplaceContainer(outputPath, fit)
+				fileName = filepath.Base(outputPath)
+			}
+		}
+	}
+
+	mylog.Infof("准备将 ts 文件合并成视频文件，目标视频：%s", fileName)
+	err := transfer.Instance(dmt.OriginUrl).Ts2Mp4(tsDirPath, segments, outputPath, dmt.LogBar)
 	if err != nil {
 		return errors.Wrap(err, "合并失败")
 	}
+	dmt.FileName = outputPath
 	if err = os.RemoveAll(tsDirPath); err != nil {
 		mylog.Errorf("临时目录删除失败，目标视频：%s", fileName)
 	}
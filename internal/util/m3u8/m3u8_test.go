@@ -6,6 +6,7 @@ import (
 	"testing"
 	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/transfer"
 	"video-downloader-go/internal/util/m3u8"
 )
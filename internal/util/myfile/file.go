@@ -53,6 +53,15 @@ func DeleteAnyFileContainsPrefix(fp string) (int, int, error) {
 	return scanCnt, delCnt, nil
 }
 
+// CreateEmpty 创建一个空文件, 文件已存在时清空其内容
+func CreateEmpty(filePath string) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "清空文件失败：%v", filePath)
+	}
+	return f.Close()
+}
+
 // 删除文件，如果存在
 // @return 第一个参数表示文件是否存在，第二个参数表示删除是否成功
 func DeleteFileIfExist(filePath string) (bool, bool) {
@@ -3,6 +3,8 @@ package myfile_test
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
 	"video-downloader-go/internal/util/myfile"
 )
@@ -40,3 +42,16 @@ func TestDeleteAnyFileContainsName(t *testing.T) {
 	}
 	log.Printf("匹配个数：%d, 删除个数：%d", s, d)
 }
+
+func TestCreateEmpty(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "1.mp4")
+	if err := os.WriteFile(p, []byte("old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := myfile.CreateEmpty(p); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Stat(p); err != nil || stat.Size() != 0 {
+		t.Errorf("文件没有被清空: %v", err)
+	}
+}
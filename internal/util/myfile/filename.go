@@ -0,0 +1,87 @@
+package myfile
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"video-downloader-go/internal/util/mytpl"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FilenameReplacement 文件名中的非法字符统一替换为该字符
+const FilenameReplacement = "_"
+
+// SanitizeFilename 将单个文件名 (不含目录) 处理为当前系统下合法的文件名
+//
+// 统一为 NFC 形式, 避免同一个标题在不同系统下生成不同的文件名,
+// 并替换掉控制字符、路径分隔符以及当前系统不允许出现的字符
+func SanitizeFilename(name string) string {
+	name = norm.NFC.String(name)
+	sb := strings.Builder{}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == '/' || r == '\\' || strings.ContainsRune(invalidFilenameChars, r) {
+			sb.WriteString(FilenameReplacement)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	name = strings.TrimSpace(sb.String())
+	if name == "." || name == ".." {
+		return FilenameReplacement
+	}
+	return sanitizeOsFilename(name)
+}
+
+// TruncateFilename 将文件名截断到 maxBytes 个字节以内, 保留后缀, 不会截断多字节字符
+func TruncateFilename(name string, maxBytes int) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) >= maxBytes {
+		ext = ""
+	}
+	stem := name[:len(name)-len(filepath.Ext(name))]
+	limit := maxBytes - len(ext)
+	for len(stem) > limit {
+		_, size := utf8.DecodeLastRuneInString(stem)
+		stem = stem[:len(stem)-size]
+	}
+	return strings.TrimSpace(stem) + ext
+}
+
+// RenderFilename 使用文件名模板生成相对路径
+//
+// 模板中使用 / 分隔子目录, 变量的值中出现的分隔符不会产生子目录,
+// 不存在的变量会被替换为空串, 替换后为空的目录层级会被忽略,
+// 每一层都会经过 SanitizeFilename 处理, 并截断到 maxBytes 个字节以内
+func RenderFilename(tpl string, vars map[string]string, maxBytes int) string {
+	rendered := mytpl.RenderFunc(tpl, func(key string) (string, bool) {
+		v := strings.NewReplacer("/", FilenameReplacement, "\\", FilenameReplacement).Replace(vars[key])
+		return v, true
+	})
+
+	parts := []string{}
+	for _, part := range strings.FieldsFunc(rendered, func(r rune) bool { return r == '/' || r == '\\' }) {
+		part = trimDangling(SanitizeFilename(part))
+		if part == "" {
+			continue
+		}
+		parts = append(parts, TruncateFilename(part, maxBytes))
+	}
+	return filepath.Join(parts...)
+}
+
+// trimDangling 去除因变量为空而残留在文件名两端的连接符, 如 " - 1080P.mp4" 中的 " - "
+func trimDangling(name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimFunc(strings.TrimSuffix(name, ext), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == '.'
+	})
+	if stem == "" {
+		return ""
+	}
+	return stem + ext
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package myfile
+
+// invalidFilenameChars 文件名中不允许出现的字符
+//
+// 类 unix 系统只禁止 / 和 NUL, 这里额外禁止 : 是因为 macOS 的 Finder 会将其显示为 /
+const invalidFilenameChars = ":"
+
+// sanitizeOsFilename 处理当前系统特有的文件名限制
+func sanitizeOsFilename(name string) string {
+	return name
+}
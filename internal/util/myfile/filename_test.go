@@ -0,0 +1,59 @@
+package myfile_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"video-downloader-go/internal/util/myfile"
+)
+
+func TestRenderFilename(t *testing.T) {
+	tpl := "{series}/{season}/{name} - {quality}.{ext}"
+	cases := []struct {
+		vars map[string]string
+		want string
+	}{
+		{
+			vars: map[string]string{"series": "庆余年", "season": "S01", "name": "第1集", "quality": "1080P", "ext": "mp4"},
+			want: filepath.Join("庆余年", "S01", "第1集 - 1080P.mp4"),
+		},
+		// 缺失的变量不产生空目录和多余的连接符
+		{
+			vars: map[string]string{"name": "第1集", "ext": "mp4"},
+			want: "第1集.mp4",
+		},
+		// 变量中的路径分隔符不会产生子目录
+		{
+			vars: map[string]string{"name": "AC/DC: Live", "ext": "mkv"},
+			want: "AC_DC_ Live.mkv",
+		},
+		// 防止跳出下载目录
+		{
+			vars: map[string]string{"series": "..", "name": "a", "ext": "mp4"},
+			want: filepath.Join("_", "a.mp4"),
+		},
+	}
+	for _, c := range cases {
+		if got := myfile.RenderFilename(tpl, c.vars, 200); got != c.want {
+			t.Errorf("期望: %s, 实际: %s", c.want, got)
+		}
+	}
+}
+
+func TestSanitizeFilenameNFC(t *testing.T) {
+	// e + 组合重音符 应当被规范化为单个字符 é
+	if got := myfile.SanitizeFilename("cafe\u0301.mp4"); got != "caf\u00e9.mp4" {
+		t.Errorf("NFC 规范化失败: %q", got)
+	}
+}
+
+func TestTruncateFilename(t *testing.T) {
+	name := strings.Repeat("名", 100) + ".mp4"
+	got := myfile.TruncateFilename(name, 50)
+	if len(got) > 50 || !strings.HasSuffix(got, ".mp4") {
+		t.Errorf("截断异常: %s, 长度: %d", got, len(got))
+	}
+	if got != strings.Repeat("名", 15)+".mp4" {
+		t.Errorf("截断位置异常: %s", got)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+// +build windows
+
+package myfile
+
+import "strings"
+
+// invalidFilenameChars 文件名中不允许出现的字符
+const invalidFilenameChars = `<>:"|?*`
+
+// reservedFilenames windows 下保留的设备名, 无论是否带后缀都不能作为文件名
+var reservedFilenames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// sanitizeOsFilename 处理当前系统特有的文件名限制
+func sanitizeOsFilename(name string) string {
+	// windows 会忽略文件名结尾的 . 和空格
+	name = strings.TrimRight(name, ". ")
+	stem, _, _ := strings.Cut(name, ".")
+	if _, ok := reservedFilenames[strings.ToUpper(stem)]; ok {
+		name = FilenameReplacement + name
+	}
+	return name
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -54,27 +53,52 @@ func GenDefaultHeaderMapByUrl(baseMap map[string]string, url string) map[string]
 	return baseMap
 }
 
-// 获取一个有超时限制的 http 请求客户端（单例模式）
+// 获取一个有超时限制的 http 请求客户端（单例模式），使用全局配置的代理和连接池
 var TimeoutHttpClient = (func() func() *http.Client {
 	var client *http.Client = nil
 	var once sync.Once
 	return func() *http.Client {
 		once.Do(func() {
-			transport := http.Transport{
-				Dial:                  (&net.Dialer{Timeout: ConnectTimeout}).Dial,
-				ResponseHeaderTimeout: ReadTimeout,
-			}
-			client = &http.Client{Transport: &transport}
+			client = &http.Client{Transport: transportOf(defaultProfile())}
 		})
 		return client
 	}
 })()
 
-// 下载一个网络资源到本地的文件上，并进行网络限速
+// NewClient 返回一个使用指定连接池和 cookie jar 的 http 请求客户端，与 TimeoutHttpClient 的超时限制相同
+// 连接池配置相同的客户端共用连接
+// @param jar 任务的 cookie jar，可以为空
+// @param profile 连接池配置，通过 ProfileOf 获取
+func NewClient(jar http.CookieJar, profile Profile) *http.Client {
+	if jar == nil && profile == defaultProfile() {
+		return TimeoutHttpClient()
+	}
+	return &http.Client{Transport: transportOf(profile), Jar: jar}
+}
+
+// clientOrDefault client 为空时返回 TimeoutHttpClient
+func clientOrDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return TimeoutHttpClient()
+	}
+	return client
+}
+
+// 下载一个网络资源到本地的文件上，并使用全局令牌桶进行网络限速
 // @param request 构造好的请求对象
 // @param destPath 要下载到本地文件的绝对路径
 // @return 下载成功时，返回下载的字节数，下载失败则返回错误
 func DownloadWithRateLimitV2(request *http.Request, destPath string) (int64, error) {
+	return DownloadWithBucket(request, destPath, mytokenbucket.GlobalBucket, nil)
+}
+
+// 下载一个网络资源到本地的文件上，并使用指定的令牌桶进行网络限速
+// @param request 构造好的请求对象
+// @param destPath 要下载到本地文件的绝对路径
+// @param bucket 限速使用的令牌桶，不是全局令牌桶时，下载的字节数同样计入全局的下载速率
+// @param client 发送请求的客户端，为空时使用 TimeoutHttpClient
+// @return 下载成功时，返回下载的字节数，下载失败则返回错误
+func DownloadWithBucket(request *http.Request, destPath string, bucket *mytokenbucket.MyTokenBucket, client *http.Client) (int64, error) {
 	if request == nil {
 		return 0, errors.New("request 对象不能为空")
 	}
@@ -84,19 +108,18 @@ func DownloadWithRateLimitV2(request *http.Request, destPath string) (int64, err
 	if err != nil {
 		if util.IsRetryableError(err) {
 			util.PrintRetryError("打开文件 ["+destPath+"] 失败", err, 1)
-			return DownloadWithRateLimitV2(request, destPath)
+			return DownloadWithBucket(request, destPath, bucket, client)
 		}
 		return 0, fmt.Errorf("打开文件 [%s] 失败: %v", destPath, err)
 	}
 	defer destFile.Close()
 
 	// 发起请求获取响应
-	client := TimeoutHttpClient()
-	resp, err := client.Do(request)
+	resp, err := clientOrDefault(client).Do(request)
 	if err != nil {
 		if util.IsRetryableError(err) {
 			util.PrintRetryError("发送请求失败", err, 2)
-			return DownloadWithRateLimitV2(request, destPath)
+			return DownloadWithBucket(request, destPath, bucket, client)
 		}
 		return 0, fmt.Errorf("发送请求失败: %v", err)
 	}
@@ -108,7 +131,7 @@ func DownloadWithRateLimitV2(request *http.Request, destPath string) (int64, err
 			return 0, errors.New("检测到 416 错误码")
 		}
 		util.PrintRetryError(fmt.Sprintf("错误码：%v", resp.StatusCode), err, 2)
-		return DownloadWithRateLimitV2(request, destPath)
+		return DownloadWithBucket(request, destPath, bucket, client)
 	}
 
 	// 从 Content-Range 响应头中读取出起始字节
@@ -130,7 +153,6 @@ func DownloadWithRateLimitV2(request *http.Request, destPath string) (int64, err
 	reader := bufio.NewReader(resp.Body)
 
 	// 不断获取令牌, 将响应的数据写入文件中
-	bucket := mytokenbucket.GlobalBucket
 	var n int
 	var totalBytes int64
 	for {
@@ -167,6 +189,9 @@ func DownloadWithRateLimitV2(request *http.Request, destPath string) (int64, err
 			}
 			totalBytes += int64(n)
 			bucket.CompleteConsume(int64(n))
+			if global := mytokenbucket.GlobalBucket; global != nil && global != bucket {
+				global.CompleteConsume(int64(n))
+			}
 		}
 
 		// 如果已经读取到文件末尾, 停止读取
@@ -315,8 +340,9 @@ func Is2xxSuccess(code int) bool {
 // @param method 请求方法
 // @param headers 请求头
 // @param from 作为返回值数组中的第一个值
+// @param client 发送请求的客户端，为空时使用 TimeoutHttpClient
 // @return 字节范围
-func GetRequestRangesFrom(url, method string, headers map[string]string, from int64) ([]int64, error) {
+func GetRequestRangesFrom(url, method string, headers map[string]string, from int64, client *http.Client) ([]int64, error) {
 	if len(url) == 0 || headers == nil {
 		return nil, errors.New("url 和 headers 必传")
 	}
@@ -325,15 +351,14 @@ func GetRequestRangesFrom(url, method string, headers map[string]string, from in
 	if err != nil {
 		return nil, errors.Wrap(err, "构造请求失败")
 	}
-	req.Header.Set("Connection", "Close")
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-	resp, err := TimeoutHttpClient().Do(req)
+	resp, err := clientOrDefault(client).Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, util.NetworkError.Error())
 	}
-	defer resp.Body.Close()
+	defer DrainBody(resp.Body)
 	if !Is2xxSuccess(resp.StatusCode) {
 		return nil, errors.New(fmt.Sprintf("连接远程地址失败，错误码：%d", resp.StatusCode))
 	}
@@ -364,12 +389,12 @@ func GetRequestRanges(url, method string, headers map[string]string) ([]int64, e
 		ranges = headers[strings.ToLower(HttpHeaderRangesKey)]
 	}
 	if len(ranges) == 0 {
-		return GetRequestRangesFrom(url, method, headers, 0)
+		return GetRequestRangesFrom(url, method, headers, 0, nil)
 	}
 	regex := regexp.MustCompile(HttpHeaderRangesPattern)
 	if !regex.MatchString(ranges) {
 		// 请求头不合法，忽略
-		return GetRequestRangesFrom(url, method, headers, 0)
+		return GetRequestRangesFrom(url, method, headers, 0, nil)
 	}
 	m := regex.FindStringSubmatch(ranges)
 	from, to := m[1], m[2]
@@ -383,7 +408,7 @@ func GetRequestRanges(url, method string, headers map[string]string) ([]int64, e
 		if fi, err := strconv.ParseInt(from, 10, 64); err != nil {
 			return nil, errors.Wrap(err, "错误的 Range 头")
 		} else {
-			return GetRequestRangesFrom(url, method, headers, fi)
+			return GetRequestRangesFrom(url, method, headers, fi, nil)
 		}
 	}
 	// 两者都有，直接返回
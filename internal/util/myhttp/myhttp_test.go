@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"testing"
 	"video-downloader-go/internal/config"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/util/myhttp"
 )
 
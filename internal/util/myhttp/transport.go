@@ -0,0 +1,188 @@
+package myhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+	"video-downloader-go/internal/config"
+)
+
+const (
+	KeepAlive           = 30 * time.Second // tcp keep-alive 探测间隔
+	TLSHandshakeTimeout = 30 * time.Second // TLS 握手的超时时间
+	IdleConnTimeout     = 90 * time.Second // 空闲连接保留的时间, 超过后关闭
+	IdleHostsPerProfile = 4                // 每个连接池预留空闲连接的域名数, m3u8、分片和密钥通常只分布在少数几个域名上
+	MaxDrainBytes       = 64 << 10         // 关闭响应体前最多读取的字节数, 读完的连接才能放回连接池复用
+)
+
+// Profile 连接池的配置, 匹配同一个定制化配置的任务得到相同的 Profile, 共用一个连接池
+type Profile struct {
+	Proxy        *config.Proxy // 代理配置
+	IdlePerHost  int           // 每个域名最多保留的空闲连接数, 为分片下载的线程数
+	DisableHTTP2 bool          // 只使用 HTTP/1.1
+}
+
+// ProfileOf 返回源视频地址对应的连接池配置
+func ProfileOf(originUrl string) Profile {
+	dl := &config.G.Downloader
+	return Profile{
+		Proxy:        config.G.Proxy.CustomProxy(originUrl),
+		IdlePerHost:  dl.CustomDlThreadCount(originUrl),
+		DisableHTTP2: !dl.CustomHTTP2(originUrl),
+	}
+}
+
+// defaultProfile 返回全局配置对应的连接池配置
+func defaultProfile() Profile {
+	dl := &config.G.Downloader
+	return Profile{
+		Proxy:        &config.G.Proxy,
+		IdlePerHost:  dl.DlThreadCount,
+		DisableHTTP2: dl.HTTP2 == config.DownloadHTTP2Deactive,
+	}
+}
+
+// transports 每个连接池配置对应的连接池
+var transports sync.Map
+
+// transportOf 返回连接池配置对应的连接池
+func transportOf(p Profile) http.RoundTripper {
+	if t, ok := transports.Load(p); ok {
+		return t.(http.RoundTripper)
+	}
+	t, _ := transports.LoadOrStore(p, newTransport(p))
+	return t.(http.RoundTripper)
+}
+
+// newTransport 创建连接池
+//
+// 空闲连接数与分片下载线程数一致, 下载 ts 分片时每个线程都可以复用自己的连接, 不需要重新握手
+func newTransport(p Profile) *meteredTransport {
+	idle := max(p.IdlePerHost, http.DefaultMaxIdleConnsPerHost)
+	dialer := &net.Dialer{Timeout: ConnectTimeout, KeepAlive: KeepAlive}
+	t := &http.Transport{
+		Proxy:                 p.Proxy.Func(),
+		DialContext:           meteredDial(dialer.DialContext),
+		ForceAttemptHTTP2:     !p.DisableHTTP2,
+		TLSHandshakeTimeout:   TLSHandshakeTimeout,
+		ResponseHeaderTimeout: ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          idle * IdleHostsPerProfile,
+		MaxIdleConnsPerHost:   idle,
+		IdleConnTimeout:       IdleConnTimeout,
+	}
+	if p.DisableHTTP2 {
+		// TLSNextProto 不为 nil 时不会协商 HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &meteredTransport{Transport: t}
+}
+
+// DrainBody 读取并关闭响应体, 剩余内容不超过 MaxDrainBytes 时连接可以被复用
+func DrainBody(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, MaxDrainBytes))
+	body.Close()
+}
+
+// ConnStats 连接层面的统计数据
+type ConnStats struct {
+	Requests      int64 // 收到响应的请求数
+	Reused        int64 // 复用已有连接的请求数
+	HTTP2         int64 // 使用 HTTP/2 的请求数
+	Dials         int64 // 新建的 tcp 连接数, 使用代理时为到代理的连接
+	DialErrors    int64 // 建立连接失败的次数
+	TLSHandshakes int64 // 完成的 TLS 握手次数
+	Active        int64 // 当前打开的连接数
+}
+
+// stats 所有连接池共用的统计数据
+var stats struct {
+	requests, reused, http2, dials, dialErrors, tlsHandshakes, active atomic.Int64
+}
+
+// Stats 返回程序启动以来的连接统计数据
+func Stats() ConnStats {
+	return ConnStats{
+		Requests:      stats.requests.Load(),
+		Reused:        stats.reused.Load(),
+		HTTP2:         stats.http2.Load(),
+		Dials:         stats.dials.Load(),
+		DialErrors:    stats.dialErrors.Load(),
+		TLSHandshakes: stats.tlsHandshakes.Load(),
+		Active:        stats.active.Load(),
+	}
+}
+
+// ReuseRate 返回复用已有连接的请求占比
+func (s ConnStats) ReuseRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(s.Requests)
+}
+
+func (s ConnStats) String() string {
+	return fmt.Sprintf("请求 %d 次, 复用连接 %.1f%%, HTTP/2 %d 次, 新建连接 %d 个 (失败 %d 次), TLS 握手 %d 次",
+		s.Requests, s.ReuseRate()*100, s.HTTP2, s.Dials, s.DialErrors, s.TLSHandshakes)
+}
+
+// meteredTransport 记录连接统计数据的连接池
+type meteredTransport struct {
+	*http.Transport
+}
+
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				stats.reused.Add(1)
+			}
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				stats.tlsHandshakes.Add(1)
+			}
+		},
+	}
+	resp, err := t.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+	stats.requests.Add(1)
+	if resp.ProtoMajor == 2 {
+		stats.http2.Add(1)
+	}
+	return resp, nil
+}
+
+// meteredDial 包装建立连接的函数, 统计新建和当前打开的连接数
+func meteredDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			stats.dialErrors.Add(1)
+			return nil, err
+		}
+		stats.dials.Add(1)
+		stats.active.Add(1)
+		return &meteredConn{Conn: conn}, nil
+	}
+}
+
+// meteredConn 关闭时减少当前打开的连接数
+type meteredConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *meteredConn) Close() error {
+	c.once.Do(func() { stats.active.Add(-1) })
+	return c.Conn.Close()
+}
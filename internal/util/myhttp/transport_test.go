@@ -0,0 +1,110 @@
+package myhttp_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"video-downloader-go/internal/config"
+	"video-downloader-go/internal/util/myhttp"
+)
+
+// newSegmentServer 返回一个模拟 ts 分片的服务器, 每个响应 1KB
+func newSegmentServer() *httptest.Server {
+	body := strings.Repeat("x", 1024)
+	return httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+}
+
+// fetchAll 使用 workers 个协程请求 n 次地址
+func fetchAll(t *testing.T, client *http.Client, link string, n, workers int) {
+	var wg sync.WaitGroup
+	ch := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		ch <- struct{}{}
+	}
+	close(ch)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ch {
+				ranges, err := myhttp.GetRequestRangesFrom(link, http.MethodGet, map[string]string{}, 0, client)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ranges[1] != 1024 {
+					t.Errorf("Content-Length 错误：%d", ranges[1])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConnectionReuse(t *testing.T) {
+	srv := newSegmentServer()
+	srv.Start()
+	defer srv.Close()
+
+	client := myhttp.NewClient(nil, myhttp.Profile{Proxy: &config.Proxy{}, IdlePerHost: 4})
+	before := myhttp.Stats()
+	fetchAll(t, client, srv.URL, 40, 4)
+	after := myhttp.Stats()
+
+	if got := after.Requests - before.Requests; got != 40 {
+		t.Errorf("请求数错误：%d", got)
+	}
+	if dials := after.Dials - before.Dials; dials > 4 {
+		t.Errorf("没有复用连接, 新建了 %d 个连接", dials)
+	}
+	if reused := after.Reused - before.Reused; reused < 36 {
+		t.Errorf("复用连接的请求数过少：%d", reused)
+	}
+	if after.HTTP2 != before.HTTP2 {
+		t.Error("明文请求不应该使用 HTTP/2")
+	}
+}
+
+func TestConnectionHTTP2(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("只有 linux 可以通过 SSL_CERT_FILE 信任测试证书")
+	}
+	srv := newSegmentServer()
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// 信任测试服务器的证书, 系统证书只加载一次, 需要在发送第一个 https 请求之前设置
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(certFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSL_CERT_FILE", certFile)
+
+	for _, disable := range []bool{false, true} {
+		client := myhttp.NewClient(nil, myhttp.Profile{Proxy: &config.Proxy{}, IdlePerHost: 4, DisableHTTP2: disable})
+		before := myhttp.Stats()
+		fetchAll(t, client, srv.URL, 20, 1)
+		after := myhttp.Stats()
+
+		if got := after.TLSHandshakes - before.TLSHandshakes; got != 1 {
+			t.Errorf("disable http2: %v, TLS 握手次数错误：%d", disable, got)
+		}
+		wantHTTP2 := int64(20)
+		if disable {
+			wantHTTP2 = 0
+		}
+		if got := after.HTTP2 - before.HTTP2; got != wantHTTP2 {
+			t.Errorf("disable http2: %v, HTTP/2 请求数错误：%d", disable, got)
+		}
+	}
+}
@@ -17,9 +17,10 @@ const (
 
 // 任务执行子状态
 const (
-	BarChildStatusDecode   = iota // 正在解析
-	BarChildStatusDownload        // 正在下载
-	BarChildStatusTransfer        // 正在转换
+	BarChildStatusDecode      = iota // 正在解析
+	BarChildStatusDownload           // 正在下载
+	BarChildStatusTransfer           // 正在转换
+	BarChildStatusPostProcess        // 正在后处理
 )
 
 // BarOption 是 Bar 结构的初始化函数
@@ -132,6 +133,15 @@ func (b *Bar) TransferHint(hint string) {
 	b.ChildStatus = BarChildStatusTransfer
 }
 
+// PostProcessHint 更新提示信息, 并标记为正在后处理
+func (b *Bar) PostProcessHint(hint string) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.Hint = hint
+	b.Status = BarStatusExecuting
+	b.ChildStatus = BarChildStatusPostProcess
+}
+
 // UpdatePercentAndSize 更新百分比和大小, 当且仅当传入值合法时才会更新
 func (b *Bar) UpdatePercentAndSize(percent int, size int64) {
 	b.Mu.Lock()
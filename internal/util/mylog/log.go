@@ -2,6 +2,8 @@ package mylog
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 	"video-downloader-go/internal/appctx"
 	"video-downloader-go/internal/util/mylog/color"
@@ -19,27 +21,35 @@ var (
 	GlobalPanel *Panel
 
 	// blockFlag 为 true 时, 不输出日志面板
-	blockFlag bool = false
+	blockFlag atomic.Bool
 
 	// doNotClear 为 true 时, 在打印面板的时候不清空旧日志
-	doNotClear bool = true
+	doNotClear atomic.Bool
+
+	// consoleMu 控制台独占锁, 同一时间只允许一个协程阻塞面板并读取用户输入
+	consoleMu sync.Mutex
 )
 
 func init() {
+	doNotClear.Store(true)
 	GlobalPanel = NewPanel(func() string { return mytokenbucket.GlobalBucket.CurrentRateStr }, PanelMaxLogs)
 }
 
-// BlockPanel 阻塞日志面板打印
+// BlockPanel 阻塞日志面板打印, 并独占控制台
+//
+// 多个解析协程同时需要用户输入时, 后调用的协程会在这里等待, 直到前一个协程调用 UnBlockPanel
 func BlockPanel() {
-	blockFlag = true
+	consoleMu.Lock()
+	blockFlag.Store(true)
 	// 线程睡眠一个刷新周期, 确保日志面板不会中途刷新
 	time.Sleep(PanelRefreshInterval)
-	doNotClear = true
+	doNotClear.Store(true)
 }
 
-// UnBlockPanel 取消阻塞日志面板打印
+// UnBlockPanel 取消阻塞日志面板打印, 释放控制台, 必须与 BlockPanel 成对调用
 func UnBlockPanel() {
-	blockFlag = false
+	blockFlag.Store(false)
+	consoleMu.Unlock()
 }
 
 // Start 启动一个协程, 持续监听并输出任务日志
@@ -55,15 +65,15 @@ func Start() {
 			select {
 			case <-ctx.Done():
 				// 程序终止信号, 最后输出一次日志, 然后退出
-				GlobalPanel.PrintLogPanel(!doNotClear)
+				GlobalPanel.PrintLogPanel(!doNotClear.Load())
 				return
 			case <-ticker.C:
-				if blockFlag {
+				if blockFlag.Load() {
 					continue
 				}
-				GlobalPanel.PrintLogPanel(!doNotClear)
+				GlobalPanel.PrintLogPanel(!doNotClear.Load())
 				// 每次正常打印完成后, 下一次打印都需要清空旧日志
-				doNotClear = false
+				doNotClear.Store(false)
 			}
 		}
 	}()
@@ -0,0 +1,83 @@
+// 可阻塞等待的计数信号量
+package mysemaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore 计数信号量, 用于限制同时处理中的任务数
+type Semaphore struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int // 容量
+	used int // 已被占用的数量, 可能因为 Occupy 超出容量
+}
+
+// New 创建一个指定容量的信号量, 容量小于 1 时按照 1 处理
+func New(size int) *Semaphore {
+	s := &Semaphore{size: max(size, 1)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Acquire 占用一个位置, 没有空闲位置时阻塞等待, 直到有位置被释放或者 ctx 结束
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// ctx 结束时唤醒等待者, 由等待者自行检查 ctx 状态
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer stop()
+
+	for s.used >= s.size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.used++
+	return nil
+}
+
+// TryAcquire 尝试占用一个位置, 没有空闲位置时立即返回 false
+func (s *Semaphore) TryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used >= s.size {
+		return false
+	}
+	s.used++
+	return true
+}
+
+// Occupy 不经等待直接占用 n 个位置, 占用后可能超出容量, 用于登记已经在处理中的任务
+func (s *Semaphore) Occupy(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used += n
+}
+
+// Release 释放一个位置, 唤醒等待者
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used > 0 {
+		s.used--
+	}
+	s.cond.Broadcast()
+}
+
+// Free 返回当前空闲的位置数
+func (s *Semaphore) Free() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return max(s.size-s.used, 0)
+}
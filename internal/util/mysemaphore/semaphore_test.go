@@ -0,0 +1,90 @@
+package mysemaphore_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"video-downloader-go/internal/util/mysemaphore"
+)
+
+func TestSemaphore(t *testing.T) {
+	s := mysemaphore.New(2)
+	ctx := context.Background()
+	s.Acquire(ctx)
+	s.Acquire(ctx)
+	if s.Free() != 0 {
+		t.Fatalf("空闲位置数异常: %d", s.Free())
+	}
+
+	// 没有空闲位置时阻塞, 释放后立即唤醒
+	acquired := make(chan struct{})
+	go func() {
+		s.Acquire(ctx)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("没有空闲位置时应该阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放位置后等待者没有被唤醒")
+	}
+
+	// ctx 结束时返回
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx 结束时应该返回 ctx 的错误: %v", err)
+	}
+
+	// 超出容量的占用需要释放到容量以内才有空闲位置
+	s.Occupy(1)
+	s.Release()
+	if s.Free() != 0 {
+		t.Fatalf("空闲位置数异常: %d", s.Free())
+	}
+	s.Release()
+	if s.Free() != 1 {
+		t.Fatalf("空闲位置数异常: %d", s.Free())
+	}
+
+	// 有空闲位置时直接占用, 没有时立即返回
+	if !s.TryAcquire() || s.TryAcquire() {
+		t.Fatalf("尝试占用的结果异常, 空闲位置数: %d", s.Free())
+	}
+}
+
+func TestSemaphoreConcurrent(t *testing.T) {
+	const size = 3
+	s := mysemaphore.New(size)
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Acquire(context.Background())
+			cur := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			s.Release()
+		}()
+	}
+	wg.Wait()
+	if peak > size {
+		t.Fatalf("同时占用的位置数超出容量: %d", peak)
+	}
+}
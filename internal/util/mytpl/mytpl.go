@@ -0,0 +1,29 @@
+// 简单的 {变量} 模板渲染
+package mytpl
+
+import "regexp"
+
+// varRegex 匹配模板中的变量, 如 {name}
+var varRegex = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// Render 将模板中的 {变量} 替换为 vars 中对应的值
+//
+// 在 vars 中不存在的变量原样保留
+func Render(tpl string, vars map[string]string) string {
+	return RenderFunc(tpl, func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	})
+}
+
+// RenderFunc 将模板中的 {变量} 替换为 valueOf 返回的值
+//
+// valueOf 的第二个返回值为 false 时, 变量原样保留
+func RenderFunc(tpl string, valueOf func(key string) (string, bool)) string {
+	return varRegex.ReplaceAllStringFunc(tpl, func(m string) string {
+		if v, ok := valueOf(m[1 : len(m)-1]); ok {
+			return v
+		}
+		return m
+	})
+}
@@ -0,0 +1,14 @@
+package mytpl_test
+
+import (
+	"testing"
+	"video-downloader-go/internal/util/mytpl"
+)
+
+func TestRender(t *testing.T) {
+	vars := map[string]string{"name": "第一集", "ext": "mp4"}
+	got := mytpl.Render("{host}/{name}.{ext}", vars)
+	if got != "{host}/第一集.mp4" {
+		t.Fatalf("渲染结果异常: %s", got)
+	}
+}
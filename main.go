@@ -2,26 +2,60 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"video-downloader-go/internal/appctx"
+	"video-downloader-go/internal/archive"
 	"video-downloader-go/internal/config"
 	"video-downloader-go/internal/decoder"
+	_ "video-downloader-go/internal/decoder/all"
 	"video-downloader-go/internal/downloader"
+	"video-downloader-go/internal/jobstore"
 	"video-downloader-go/internal/meta"
+	"video-downloader-go/internal/report"
+	"video-downloader-go/internal/util/myhttp"
 	"video-downloader-go/internal/util/mylog"
 	"video-downloader-go/internal/util/mylog/color"
 	"video-downloader-go/internal/util/mylog/dlbar"
+	"video-downloader-go/internal/util/mysemaphore"
 
 	"github.com/pkg/errors"
 )
 
 const CurrentVersion = "1.9.0"
 
+// DataFilePath 任务文件路径
+const DataFilePath = "config/data.txt"
+
+// force 忽略下载存档, 重新下载已经下载过的任务
+var force = flag.Bool("force", false, "忽略下载存档, 重新下载已经下载过的任务")
+
+// 程序退出码
+const (
+	ExitOk         = 0 // 所有任务处理成功
+	ExitError      = 1 // 程序初始化失败
+	ExitTaskFailed = 2 // 存在处理失败的任务
+)
+
 func main() {
+	os.Exit(run())
+}
+
+// run 执行程序的主流程, 返回程序的退出码
+func run() int {
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "archive":
+		return runArchiveCommand(flag.Args()[1:])
+	case "config":
+		return runConfigCommand(flag.Args()[1:])
+	}
+
 	defer appctx.WaitGroup().Wait()
 	defer appctx.CancelFunc()()
 
@@ -33,48 +67,112 @@ func main() {
 	err := config.Load("")
 	if err != nil {
 		fmt.Println(color.ToRed(err.Error()))
-		return
+		return ExitError
 	}
 	fmt.Println(color.ToGreen("读取完成"))
 
+	// 读取下载存档
+	archive.G, err = archive.Open(archive.DefaultPath)
+	if err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+		return ExitError
+	}
+
+	// 读取任务存储
+	jobstore.G, err = jobstore.Open(jobstore.DefaultPath)
+	if err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+		return ExitError
+	}
+
 	// 读取要处理的视频数据
 	fmt.Println(color.ToBlue("正在读取待处理任务..."))
-	decodeList, err := readVideoData()
+	videoList, lineIds, err := readVideoData(*force)
 	if err != nil {
 		fmt.Println(color.ToRed(err.Error()))
-		return
+		return ExitError
+	}
+	decodeList, downloadList, err := restoreTasks(videoList, *force)
+	if err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+		return ExitError
 	}
 	fmt.Println(color.ToGreen("读取完成"))
-	if decodeList.Empty() {
-		fmt.Println(color.ToBlue("解析列表为空，程序停止"))
-		return
+	taskCnt := decodeList.Size() + downloadList.Size()
+	if taskCnt == 0 {
+		fmt.Println(color.ToBlue("任务列表为空，程序停止"))
+		return ExitOk
 	}
-	downloadList := new(meta.TaskDeque[meta.Download])
 	fmt.Println(color.ToGreen("程序初始化完成, 开始处理任务..."))
 
 	mylog.Start()
 
+	// 等待时间较长的任务逐渐提高优先级, 并监听任务文件中优先级的修改
+	decodeList.SetAging(meta.DefaultPriorityAging)
+	downloadList.SetAging(meta.DefaultPriorityAging)
+	go watchPriorities(decodeList, downloadList, lineIds)
+
+	// 每个任务最终都会成功或者失败, 两者都计入完成数
+	var taskWg sync.WaitGroup
+	taskWg.Add(taskCnt)
+	remainCnt := int64(taskCnt)
+	rp := report.New()
+	// 同时处于下载中和解析完成等待下载的任务数, 任务处理结束后释放位置, 解析器才会解析下一个任务
+	slots := mysemaphore.New(config.G.Downloader.TaskThreadCount + config.G.Decoder.Prefetch)
+	slots.Occupy(downloadList.Size())
+	finishOne := func(e report.Entry) {
+		slots.Release()
+		rp.Add(e)
+		remain := atomic.AddInt64(&remainCnt, -1)
+		if e.State == meta.TaskFailed {
+			mylog.Errorf("一个任务处理失败：%v，剩余：%v 个", e.Name, remain)
+		} else {
+			mylog.Successf("一个文件下载完成，剩余：%v 个", remain)
+		}
+		taskWg.Done()
+	}
+
 	// 开启解析任务
-	decoder.ListenAndDecode(decodeList, func(d *meta.Download) {
-		downloadList.OfferLast(d)
+	decoder.ListenAndDecode(decodeList, slots, func(d *meta.Download) {
+		downloadList.Offer(d, d.Priority)
+	}, func(v *meta.Video, err error) {
+		finishOne(report.FromVideo(v, err))
 	})
 
 	// 开启下载任务
-	var downloadWg sync.WaitGroup
-	remainCnt := int64(decodeList.Size())
-	downloadWg.Add(decodeList.Size())
-	downloader.ListenAndDownload(downloadList, func() {
-		downloadWg.Done()
-		atomic.AddInt64(&remainCnt, -1)
-		mylog.Successf("一个文件下载完成，剩余：%v 个", remainCnt)
+	downloader.ListenAndDownload(downloadList, func(dmt *meta.Download, err error) {
+		finishOne(report.FromDownload(dmt, err))
 	}, func(dmt *meta.Download) {
-		// 下载器判断出无法正常下载的视频，重新加入到解析列表中
-		fileName, originUrl := dmt.FileName, dmt.OriginUrl
+		// 下载器判断出无法正常下载的视频，重新加入到解析列表中, 解析器会重新占用位置
+		slots.Release()
 		dmt.LogBar.WaitingHint("正在等待解析")
-		decodeList.OfferLast(&meta.Video{Name: fileName, Url: originUrl, LogBar: dmt.LogBar})
+		decodeList.Offer(&meta.Video{
+			Id: dmt.Id, Name: dmt.Name, Url: dmt.OriginUrl, LogBar: dmt.LogBar, Tries: dmt.Tries, Priority: dmt.Priority, Headers: dmt.Headers,
+		}, dmt.Priority)
 	})
-	downloadWg.Wait()
+	taskWg.Wait()
+	decodeList.Close()
+	downloadList.Close()
 	mylog.Success("所有任务处理完成")
+
+	// 先停止日志面板再输出处理结果, 避免被面板刷新覆盖
+	appctx.CancelFunc()()
+	appctx.WaitGroup().Wait()
+	rp.PrintTable(os.Stdout)
+	if cs := myhttp.Stats(); cs.Requests > 0 {
+		fmt.Printf("连接统计：%s\n", cs)
+	}
+	if err = rp.WriteJSON(report.DefaultJSONPath); err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+	}
+	if err = rp.WriteFailed(report.DefaultFailedPath); err != nil {
+		fmt.Println(color.ToRed(err.Error()))
+	}
+	if failed := len(rp.Failed()); failed > 0 {
+		fmt.Println(color.ToRed(fmt.Sprintf("%d 个任务处理失败，已写入 %s，可将其内容复制到 data.txt 中重新下载", failed, report.DefaultFailedPath)))
+		return ExitTaskFailed
+	}
+	return ExitOk
 }
 
 // printBanner 输出 banner
@@ -86,14 +184,67 @@ func printBanner() {
 	fmt.Println(string(bannerBytes))
 }
 
+// dedupeOutputPaths 在开始下载之前检查任务的输出路径是否重复
+// 重复的任务会在名称后追加序号, 避免后面的任务覆盖或者因文件已存在而跳过
+func dedupeOutputPaths(list *meta.TaskDeque[meta.Video]) {
+	seen := make(map[string]struct{})
+	list.Range(func(item *meta.Video, index int) {
+		path, err := downloader.PredictOutputPath(item.Name, item.Url)
+		if err != nil {
+			return
+		}
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			return
+		}
+
+		origin, dup := item.Name, path
+		for i := 2; ; i++ {
+			item.Name = fmt.Sprintf("%s (%d)", origin, i)
+			path, err = downloader.PredictOutputPath(item.Name, item.Url)
+			if err != nil || path == dup {
+				// 文件名模板中没有使用任务名称, 只能交给下载时的冲突处理
+				item.Name = origin
+				mylog.Warnf("第 %d 个任务的输出路径与之前的任务重复：%s", index+1, dup)
+				return
+			}
+			if _, ok := seen[path]; !ok {
+				break
+			}
+		}
+		seen[path] = struct{}{}
+		item.LogBar.Name = item.Name
+		mylog.Warnf("第 %d 个任务的输出路径与之前的任务重复, 重命名为：%s", index+1, item.Name)
+	})
+}
+
+// taskLineKey 标识 data.txt 中的一行任务, 名称和地址都相同的任务按照出现的顺序区分
+type taskLineKey struct {
+	id string // 使用原始名称生成的任务 id
+	n  int    // 第几次出现, 从 1 开始
+}
+
+// newTaskLineKeyer 返回一个按照读取顺序为任务行生成 taskLineKey 的函数
+func newTaskLineKeyer() func(tl *meta.TaskLine) taskLineKey {
+	counts := make(map[string]int)
+	return func(tl *meta.TaskLine) taskLineKey {
+		id := jobstore.TaskId(tl.Name, tl.Url)
+		counts[id]++
+		return taskLineKey{id: id, n: counts[id]}
+	}
+}
+
 // readVideoData 读取用户在 config/data.txt 目录下配置的输入数据
-func readVideoData() (*meta.TaskDeque[meta.Video], error) {
+// 已经记录在下载存档中的任务会被跳过, force 为 true 时不跳过
+//
+// 同时返回任务行到任务 id 的映射, 重复的任务在去重时会被重命名, 无法再根据任务行直接生成 id
+func readVideoData(force bool) (*meta.TaskDeque[meta.Video], map[taskLineKey]string, error) {
 	mylog.Info("正在读取源数据文件 data.txt...")
 
 	// 打开文件
-	f, err := os.Open("config/data.txt")
+	f, err := os.Open(DataFilePath)
 	if err != nil {
-		return nil, errors.Wrap(err, "打开源数据文件失败")
+		return nil, nil, errors.Wrap(err, "打开源数据文件失败")
 	}
 	defer f.Close()
 
@@ -102,33 +253,186 @@ func readVideoData() (*meta.TaskDeque[meta.Video], error) {
 
 	// 逐行读取数据并处理
 	list := new(meta.TaskDeque[meta.Video])
+	lineKeys := make(map[*meta.Video]taskLineKey)
+	keyOf := newTaskLineKeyer()
+	skipCnt := 0
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == "" {
 			// 忽略空行
 			continue
 		}
-		arr := strings.Split(line, "|")
-		if len(arr) != 2 {
-			return nil, errors.New("文件格式不合法，请遵循：`文件名|地址`")
+		tl, err := meta.ParseTaskLine(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := keyOf(tl)
+		if r, ok := archive.G.Get(tl.Url); ok && !force {
+			mylog.Infof("已下载过，跳过任务：%v，文件：%v", tl.Name, r.Path)
+			skipCnt++
+			continue
 		}
-		bar := dlbar.NewBar(
-			dlbar.WithStatus(dlbar.BarStatusWaiting),
-			dlbar.WithHint("正在等待解析"),
-			dlbar.WithName(arr[0]),
-		)
-		list.OfferLast(&meta.Video{LogBar: bar, Name: arr[0], Url: arr[1]})
-		mylog.GlobalPanel.RegisterBar(bar)
+		vmt := &meta.Video{
+			LogBar: newTaskBar(tl.Name), Name: tl.Name, Url: tl.Url, Priority: tl.Priority, Headers: tl.Headers,
+		}
+		lineKeys[vmt] = key
+		list.Offer(vmt, tl.Priority)
 	}
 
 	if err = scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, "扫描源数据文件失败")
+		return nil, nil, errors.Wrap(err, "扫描源数据文件失败")
+	}
+
+	if skipCnt > 0 {
+		mylog.Warnf("%d 个任务已下载过，已跳过，如需重新下载请使用 -force 参数", skipCnt)
 	}
 
+	dedupeOutputPaths(list)
+	lineIds := make(map[taskLineKey]string)
 	list.Range(func(item *meta.Video, index int) {
+		// 去重之后再生成 id, 保证重复的任务各自拥有独立的记录
+		item.Id = jobstore.TaskId(item.Name, item.Url)
+		lineIds[lineKeys[item]] = item.Id
 		mylog.Infof("%v", item)
 	})
 
 	mylog.Success("读取完成！")
-	return list, nil
+	return list, lineIds, nil
+}
+
+// newTaskBar 创建一个等待解析的任务条并注册到全局面板
+func newTaskBar(name string) *dlbar.Bar {
+	bar := dlbar.NewBar(
+		dlbar.WithStatus(dlbar.BarStatusWaiting),
+		dlbar.WithHint("正在等待解析"),
+		dlbar.WithName(name),
+	)
+	mylog.GlobalPanel.RegisterBar(bar)
+	return bar
+}
+
+// restoreTasks 结合任务存储中记录的状态, 将任务分配到解析列表和下载列表
+//
+// 解析结果尚未过期的任务跳过解析直接下载, 上次运行中没有处理完成的任务即使不在 data.txt 中也会继续处理,
+// 已经记录在下载存档中的任务除外, force 为 true 时不跳过
+func restoreTasks(videos *meta.TaskDeque[meta.Video], force bool) (*meta.TaskDeque[meta.Video], *meta.TaskDeque[meta.Download], error) {
+	decodeList := new(meta.TaskDeque[meta.Video])
+	downloadList := new(meta.TaskDeque[meta.Download])
+
+	// dispatch 根据任务记录决定任务进入哪个列表
+	dispatch := func(vmt *meta.Video) error {
+		if t, ok := jobstore.G.Get(vmt.Id); ok && t.Decoded() {
+			mylog.Infof("解析结果尚未过期，直接下载：%v", vmt.Name)
+			vmt.LogBar.WaitingHint("解析完成, 等待下载")
+			// 以 data.txt 中最新的请求头为准
+			t.Headers = vmt.Headers
+			jobstore.G.Update(vmt.Id, func(t *meta.Task) {
+				t.State, t.Priority, t.Headers = meta.TaskDecoded, vmt.Priority, vmt.Headers
+			})
+			dmt := t.Download(vmt.LogBar)
+			dmt.Priority = vmt.Priority
+			downloadList.Offer(dmt, dmt.Priority)
+			return nil
+		}
+		decodeList.Offer(vmt, vmt.Priority)
+		return jobstore.G.Put(meta.Task{
+			Id: vmt.Id, Name: vmt.Name, Url: vmt.Url, State: meta.TaskQueued, Tries: vmt.Tries, Priority: vmt.Priority,
+			Headers: vmt.Headers,
+		})
+	}
+
+	seen := make(map[string]struct{})
+	var err error
+	videos.Range(func(item *meta.Video, index int) {
+		seen[item.Id] = struct{}{}
+		if err == nil {
+			err = dispatch(item)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range jobstore.G.List() {
+		if _, ok := seen[t.Id]; ok || t.Finished() {
+			continue
+		}
+		if archive.G.Has(t.Url) && !force {
+			jobstore.G.SetState(t.Id, meta.TaskDone)
+			continue
+		}
+		mylog.Infof("恢复上次未完成的任务：%v，状态：%v", t.Name, t.State)
+		if err = dispatch(t.Video(newTaskBar(t.Name))); err != nil {
+			return nil, nil, err
+		}
+	}
+	return decodeList, downloadList, nil
+}
+
+// watchPriorities 监听任务文件的修改, 将修改后的优先级应用到还在排队的任务上
+//
+// 任务行通过 lineIds 找到读取任务文件时生成的任务 id, 正在解析或下载中的任务不受影响, 程序终止时退出
+func watchPriorities(decodeList *meta.TaskDeque[meta.Video], downloadList *meta.TaskDeque[meta.Download], lineIds map[taskLineKey]string) {
+	ctx := appctx.Context()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var lastMod time.Time
+	if stat, err := os.Stat(DataFilePath); err == nil {
+		lastMod = stat.ModTime()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stat, err := os.Stat(DataFilePath)
+		if err != nil || !stat.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = stat.ModTime()
+
+		data, err := os.ReadFile(DataFilePath)
+		if err != nil {
+			mylog.Warnf("读取任务文件失败：%v", err)
+			continue
+		}
+		priorities := make(map[string]int)
+		keyOf := newTaskLineKeyer()
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			tl, err := meta.ParseTaskLine(line)
+			if err != nil {
+				mylog.Warnf("忽略不合法的任务配置：%v", err)
+				continue
+			}
+			if id, ok := lineIds[keyOf(tl)]; ok {
+				priorities[id] = tl.Priority
+			}
+		}
+
+		// 匹配到优先级发生变化的任务时, 同时修改任务本身和任务记录
+		cnt := decodeList.Reprioritize(func(v *meta.Video) (int, bool) {
+			p, ok := priorities[v.Id]
+			if ok && p != v.Priority {
+				v.Priority = p
+				jobstore.G.Update(v.Id, func(t *meta.Task) { t.Priority = p })
+			}
+			return p, ok
+		})
+		cnt += downloadList.Reprioritize(func(d *meta.Download) (int, bool) {
+			p, ok := priorities[d.Id]
+			if ok && p != d.Priority {
+				d.Priority = p
+				jobstore.G.Update(d.Id, func(t *meta.Task) { t.Priority = p })
+			}
+			return p, ok
+		})
+		if cnt > 0 {
+			mylog.Infof("任务文件已修改，更新了 %d 个任务的优先级", cnt)
+		}
+	}
 }